@@ -0,0 +1,46 @@
+package neo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// benchResponseWriter 复用同一个响应头，避免测试代码本身产生内存分配
+type benchResponseWriter struct {
+	header http.Header
+}
+
+func (w *benchResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w *benchResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w *benchResponseWriter) WriteHeader(int) {}
+
+func benchmarkServeHTTP(b *testing.B, engine *Engine, path string) {
+	req := httptest.NewRequest(http.MethodGet, path, nil)
+	w := &benchResponseWriter{header: http.Header{}}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		engine.ServeHTTP(w, req)
+	}
+}
+
+func BenchmarkServeHTTP_Static(b *testing.B) {
+	engine := New(WithMode(ReleaseMode))
+	engine.GET("/user/profile", func(ctx *Context) {})
+	engine.GET("/user/:id", func(ctx *Context) {})
+	benchmarkServeHTTP(b, engine, "/user/profile")
+}
+
+func BenchmarkServeHTTP_Param(b *testing.B) {
+	engine := New(WithMode(ReleaseMode))
+	engine.GET("/user/profile", func(ctx *Context) {})
+	engine.GET("/user/:id/order/:orderId", func(ctx *Context) {})
+	benchmarkServeHTTP(b, engine, "/user/42/order/7")
+}
@@ -0,0 +1,324 @@
+package neo
+
+import (
+	"encoding"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/textproto"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// 常用的请求体和响应体格式
+const (
+	MIMEJSON              = "application/json"
+	MIMEXML               = "application/xml"
+	MIMEXML2              = "text/xml"
+	MIMEYAML              = "application/yaml"
+	MIMEHTML              = "text/html"
+	MIMEPlain             = "text/plain"
+	MIMEPOSTForm          = "application/x-www-form-urlencoded"
+	MIMEMultipartPOSTForm = "multipart/form-data"
+)
+
+var (
+	timeType         = reflect.TypeOf(time.Time{})
+	durationType     = reflect.TypeOf(time.Duration(0))
+	fileHeaderType   = reflect.TypeOf(&multipart.FileHeader{})
+	fileHeadersType  = reflect.TypeOf([]*multipart.FileHeader{})
+	unmarshalerType  = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	errBindTarget    = errors.New("web: 绑定的目标必须是指向结构体的非空指针")
+	errEmptyBodyBind = errors.New("web: 请求体为空")
+)
+
+// bindSource 描述一次绑定的数据来源
+// tags 按顺序查找字段名，都没有时使用字段本身的名字
+type bindSource struct {
+	tags   []string
+	lookup func(name string) ([]string, bool)
+	files  map[string][]*multipart.FileHeader
+}
+
+func valuesSource(values map[string][]string, tags ...string) bindSource {
+	return bindSource{
+		tags: tags,
+		lookup: func(name string) ([]string, bool) {
+			v, ok := values[name]
+			return v, ok
+		},
+	}
+}
+
+func headerSource(header map[string][]string) bindSource {
+	return bindSource{
+		tags: []string{"header"},
+		lookup: func(name string) ([]string, bool) {
+			v, ok := header[textproto.CanonicalMIMEHeaderKey(name)]
+			return v, ok
+		},
+	}
+}
+
+func paramsSource(params Params) bindSource {
+	return bindSource{
+		tags: []string{"uri"},
+		lookup: func(name string) ([]string, bool) {
+			if v, ok := params.Get(name); ok {
+				return []string{v}, true
+			}
+			return nil, false
+		},
+	}
+}
+
+// mapForm 按照结构体标签把 source 中的数据填充到 ptr 指向的结构体中
+// 标签写法：`form:"name"`、`form:"name,default=10"`、`form:"-"` 表示忽略
+// 时间字段可以通过 `time_format:"2006-01-02"` 指定格式，也支持 unix 和 unixnano
+func mapForm(ptr any, source bindSource) error {
+	rv := reflect.ValueOf(ptr)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return errBindTarget
+	}
+	rv = rv.Elem()
+	if rv.Kind() != reflect.Struct {
+		return errBindTarget
+	}
+	return mapStruct(rv, source)
+}
+
+func mapStruct(rv reflect.Value, source bindSource) error {
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		sf := rt.Field(i)
+		if !sf.IsExported() && !sf.Anonymous {
+			continue
+		}
+		fv := rv.Field(i)
+		name, defaultValue := "", ""
+		tagged := false
+		for _, tag := range source.tags {
+			if value, ok := sf.Tag.Lookup(tag); ok {
+				name, defaultValue = parseBindTag(value)
+				tagged = true
+				break
+			}
+		}
+		if name == "-" {
+			continue
+		}
+		// 没有标签的结构体字段（包括匿名嵌入）递归绑定
+		if !tagged && isNestedStruct(fv.Type()) {
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					if !fv.CanSet() {
+						continue
+					}
+					fv.Set(reflect.New(fv.Type().Elem()))
+				}
+				fv = fv.Elem()
+			}
+			if err := mapStruct(fv, source); err != nil {
+				return err
+			}
+			continue
+		}
+		if !sf.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = sf.Name
+		}
+		// 上传的文件
+		if sf.Type == fileHeaderType || sf.Type == fileHeadersType {
+			if files := source.files[name]; len(files) > 0 {
+				if sf.Type == fileHeaderType {
+					fv.Set(reflect.ValueOf(files[0]))
+				} else {
+					fv.Set(reflect.ValueOf(files))
+				}
+			}
+			continue
+		}
+		values, ok := source.lookup(name)
+		if !ok || len(values) == 0 {
+			if defaultValue == "" {
+				continue
+			}
+			values = []string{defaultValue}
+		}
+		if err := setField(fv, values, sf); err != nil {
+			return fmt.Errorf("web: 绑定字段 %s 失败: %w", name, err)
+		}
+	}
+	return nil
+}
+
+// parseBindTag 解析 "name,default=xxx" 格式的标签
+func parseBindTag(tag string) (name string, defaultValue string) {
+	name, opts, _ := strings.Cut(tag, ",")
+	for _, opt := range strings.Split(opts, ",") {
+		if strings.HasPrefix(opt, "default=") {
+			defaultValue = strings.TrimPrefix(opt, "default=")
+		}
+	}
+	return name, defaultValue
+}
+
+// isNestedStruct 是否是需要递归绑定的结构体，time.Time 和实现了 TextUnmarshaler 的类型除外
+func isNestedStruct(t reflect.Type) bool {
+	if t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType {
+		return false
+	}
+	return !reflect.PointerTo(t).Implements(unmarshalerType)
+}
+
+// setField 设置单个字段，切片和数组使用全部的值，其他类型只使用第一个值
+func setField(fv reflect.Value, values []string, sf reflect.StructField) error {
+	switch fv.Kind() {
+	case reflect.Pointer:
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return setField(fv.Elem(), values, sf)
+	case reflect.Slice:
+		if reflect.PointerTo(fv.Type()).Implements(unmarshalerType) {
+			break
+		}
+		slice := reflect.MakeSlice(fv.Type(), len(values), len(values))
+		for i, value := range values {
+			if err := setValue(slice.Index(i), value, sf); err != nil {
+				return err
+			}
+		}
+		fv.Set(slice)
+		return nil
+	case reflect.Array:
+		if len(values) > fv.Len() {
+			return fmt.Errorf("最多只能有 %d 个值", fv.Len())
+		}
+		for i, value := range values {
+			if err := setValue(fv.Index(i), value, sf); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	return setValue(fv, values[0], sf)
+}
+
+// setValue 把单个字符串转换成字段对应的类型
+func setValue(fv reflect.Value, value string, sf reflect.StructField) error {
+	if fv.Kind() == reflect.Pointer {
+		if fv.IsNil() {
+			fv.Set(reflect.New(fv.Type().Elem()))
+		}
+		return setValue(fv.Elem(), value, sf)
+	}
+	switch fv.Type() {
+	case timeType:
+		return setTime(fv, value, sf)
+	case durationType:
+		if value == "" {
+			fv.SetInt(0)
+			return nil
+		}
+		d, err := time.ParseDuration(value)
+		if err != nil {
+			return err
+		}
+		fv.SetInt(int64(d))
+		return nil
+	}
+	if fv.CanAddr() {
+		if u, ok := fv.Addr().Interface().(encoding.TextUnmarshaler); ok {
+			return u.UnmarshalText([]byte(value))
+		}
+	}
+	switch fv.Kind() {
+	case reflect.String:
+		fv.SetString(value)
+	case reflect.Bool:
+		if value == "" {
+			fv.SetBool(false)
+			return nil
+		}
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return err
+		}
+		fv.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if value == "" {
+			fv.SetInt(0)
+			return nil
+		}
+		n, err := strconv.ParseInt(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if value == "" {
+			fv.SetUint(0)
+			return nil
+		}
+		n, err := strconv.ParseUint(value, 10, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		if value == "" {
+			fv.SetFloat(0)
+			return nil
+		}
+		f, err := strconv.ParseFloat(value, fv.Type().Bits())
+		if err != nil {
+			return err
+		}
+		fv.SetFloat(f)
+	default:
+		return fmt.Errorf("不支持的类型 %s", fv.Type())
+	}
+	return nil
+}
+
+// setTime 解析时间，time_format 默认是 RFC3339，time_utc:"1" 表示按照 UTC 解析
+func setTime(fv reflect.Value, value string, sf reflect.StructField) error {
+	if value == "" {
+		fv.Set(reflect.ValueOf(time.Time{}))
+		return nil
+	}
+	format := sf.Tag.Get("time_format")
+	switch format {
+	case "unix", "unixnano":
+		n, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return err
+		}
+		t := time.Unix(n, 0)
+		if format == "unixnano" {
+			t = time.Unix(0, n)
+		}
+		fv.Set(reflect.ValueOf(t))
+		return nil
+	case "":
+		format = time.RFC3339
+	}
+	loc := time.Local
+	if utc, _ := strconv.ParseBool(sf.Tag.Get("time_utc")); utc {
+		loc = time.UTC
+	}
+	t, err := time.ParseInLocation(format, value, loc)
+	if err != nil {
+		return err
+	}
+	fv.Set(reflect.ValueOf(t))
+	return nil
+}
@@ -0,0 +1,326 @@
+package neo
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"sync"
+)
+
+// Compressor 压缩算法抽象，实现它就可以给压缩中间件接入 brotli、zstd 等其他算法
+type Compressor interface {
+	// Encoding 返回 Content-Encoding 中的名字 例如：gzip
+	Encoding() string
+	// Writer 返回一个把压缩结果写入 w 的 Writer，可以从对象池中取
+	Writer(w io.Writer) io.WriteCloser
+	// Release 在 Writer 关闭之后归还它
+	Release(w io.WriteCloser)
+}
+
+// NewGzipCompressor 创建 gzip 压缩算法，level 取值参考 compress/gzip
+func NewGzipCompressor(level int) Compressor {
+	if _, err := gzip.NewWriterLevel(io.Discard, level); err != nil {
+		panic(fmt.Sprintf("web: 无效的 gzip 压缩级别 %d", level))
+	}
+	c := &gzipCompressor{}
+	c.pool.New = func() any {
+		w, _ := gzip.NewWriterLevel(io.Discard, level)
+		return w
+	}
+	return c
+}
+
+type gzipCompressor struct {
+	pool sync.Pool
+}
+
+func (c *gzipCompressor) Encoding() string {
+	return "gzip"
+}
+
+func (c *gzipCompressor) Writer(w io.Writer) io.WriteCloser {
+	gw := c.pool.Get().(*gzip.Writer)
+	gw.Reset(w)
+	return gw
+}
+
+func (c *gzipCompressor) Release(w io.WriteCloser) {
+	c.pool.Put(w)
+}
+
+// NewDeflateCompressor 创建 deflate 压缩算法，level 取值参考 compress/flate
+func NewDeflateCompressor(level int) Compressor {
+	if _, err := flate.NewWriter(io.Discard, level); err != nil {
+		panic(fmt.Sprintf("web: 无效的 deflate 压缩级别 %d", level))
+	}
+	c := &deflateCompressor{}
+	c.pool.New = func() any {
+		w, _ := flate.NewWriter(io.Discard, level)
+		return w
+	}
+	return c
+}
+
+type deflateCompressor struct {
+	pool sync.Pool
+}
+
+func (c *deflateCompressor) Encoding() string {
+	return "deflate"
+}
+
+func (c *deflateCompressor) Writer(w io.Writer) io.WriteCloser {
+	fw := c.pool.Get().(*flate.Writer)
+	fw.Reset(w)
+	return fw
+}
+
+func (c *deflateCompressor) Release(w io.WriteCloser) {
+	c.pool.Put(w)
+}
+
+// compressConfig 压缩中间件配置
+type compressConfig struct {
+	compressors        []Compressor // 按照优先级排列
+	minLength          int
+	excludedPaths      []string
+	excludedExtensions map[string]struct{}
+}
+
+// CompressOption 压缩中间件的可选配置
+type CompressOption func(config *compressConfig)
+
+// WithMinLength 响应体小于 n 字节时不压缩，默认是 1024
+func WithMinLength(n int) CompressOption {
+	return func(config *compressConfig) {
+		config.minLength = n
+	}
+}
+
+// WithExcludedPaths 请求地址以这些前缀开头时不压缩 例如：/metrics
+func WithExcludedPaths(prefixes ...string) CompressOption {
+	return func(config *compressConfig) {
+		config.excludedPaths = append(config.excludedPaths, prefixes...)
+	}
+}
+
+// WithExcludedExtensions 请求地址是这些后缀时不压缩 例如：.png
+func WithExcludedExtensions(extensions ...string) CompressOption {
+	return func(config *compressConfig) {
+		for _, ext := range extensions {
+			config.excludedExtensions[strings.ToLower(ext)] = struct{}{}
+		}
+	}
+}
+
+// WithCompressor 添加其他压缩算法，优先级高于 gzip，按照添加顺序排列
+func WithCompressor(compressors ...Compressor) CompressOption {
+	return func(config *compressConfig) {
+		// 拼到新的切片上，不能写入调用方传入的切片的底层数组
+		config.compressors = append(append([]Compressor(nil), compressors...), config.compressors...)
+	}
+}
+
+// alreadyCompressedTypes 本身就是压缩格式的响应类型，再压缩没有意义
+var alreadyCompressedTypes = []string{
+	"image/png", "image/jpeg", "image/gif", "image/webp", "image/avif",
+	"video/", "audio/", "font/woff", "application/zip", "application/gzip",
+	"application/x-gzip", "application/x-brotli", "application/zstd",
+}
+
+// Gzip 响应压缩中间件，默认只支持 gzip，可以通过 WithCompressor 接入其他算法
+// 根据 Accept-Encoding 选择算法；响应太小、已经压缩过、206 分段响应以及排除的路径和后缀不压缩
+func Gzip(level int, opts ...CompressOption) HandlerFunc {
+	config := &compressConfig{
+		compressors:        []Compressor{NewGzipCompressor(level)},
+		minLength:          1024,
+		excludedExtensions: map[string]struct{}{},
+	}
+	for _, opt := range opts {
+		opt(config)
+	}
+
+	return func(ctx *Context) {
+		if ctx.Method == http.MethodHead || config.excluded(ctx.URL) {
+			ctx.Next()
+			return
+		}
+		// 响应内容会随着 Accept-Encoding 变化，缓存需要区分
+		ctx.Writer.Header().Add("Vary", "Accept-Encoding")
+		var compressor Compressor
+		acceptEncoding := ctx.Req.Header.Get("Accept-Encoding")
+		for _, c := range config.compressors {
+			if acceptsEncoding(acceptEncoding, c.Encoding()) {
+				compressor = c
+				break
+			}
+		}
+		if compressor == nil {
+			ctx.Next()
+			return
+		}
+		cw := &compressWriter{ResponseWriter: ctx.Writer, compressor: compressor, minLength: config.minLength}
+		ctx.Writer = cw
+		defer func() {
+			if err := recover(); err != nil {
+				// panic 时丢弃写了一半的数据，不能发出响应头，否则 Recovery 就没办法再返回 500
+				cw.abort()
+				ctx.Writer = cw.ResponseWriter
+				panic(err)
+			}
+		}()
+		ctx.Next()
+		cw.close()
+		ctx.Writer = cw.ResponseWriter
+	}
+}
+
+func (config *compressConfig) excluded(urlPath string) bool {
+	for _, prefix := range config.excludedPaths {
+		if strings.HasPrefix(urlPath, prefix) {
+			return true
+		}
+	}
+	_, ok := config.excludedExtensions[strings.ToLower(path.Ext(urlPath))]
+	return ok
+}
+
+// compressWriter 包装 ResponseWriter，先缓冲 minLength 字节再决定是否压缩
+type compressWriter struct {
+	ResponseWriter
+	compressor Compressor
+	minLength  int
+
+	buf         []byte
+	decided     bool // 是否已经决定了要不要压缩
+	compressing bool
+	w           io.WriteCloser
+}
+
+func (w *compressWriter) Write(data []byte) (int, error) {
+	if w.decided {
+		if w.compressing {
+			return w.w.Write(data)
+		}
+		return w.ResponseWriter.Write(data)
+	}
+	w.buf = append(w.buf, data...)
+	if !w.shouldCompress() {
+		w.decide(false)
+	} else if len(w.buf) >= w.minLength {
+		w.decide(true)
+	}
+	return len(data), nil
+}
+
+// Written 还在缓冲中的响应体同样算作已经写过，ErrorHandler 不能再追加错误响应
+func (w *compressWriter) Written() bool {
+	return w.ResponseWriter.Written() || len(w.buf) > 0
+}
+
+// Size 包含还在缓冲中的字节数
+func (w *compressWriter) Size() int {
+	return w.ResponseWriter.Size() + len(w.buf)
+}
+
+func (w *compressWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+// Flush 流式响应需要立即发送，没有决定是否压缩时按照当前缓冲的大小决定
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		w.decide(w.shouldCompress() && len(w.buf) >= w.minLength)
+	}
+	if w.compressing {
+		if flusher, ok := w.w.(interface{ Flush() error }); ok {
+			_ = flusher.Flush()
+		}
+	}
+	w.ResponseWriter.Flush()
+}
+
+// Reset 底层的响应还能丢弃时，同时丢弃压缩状态，重新开始
+func (w *compressWriter) Reset() bool {
+	if !w.ResponseWriter.Reset() {
+		return false
+	}
+	if w.compressing {
+		w.compressor.Release(w.w)
+		w.w = nil
+	}
+	w.buf = w.buf[:0]
+	w.decided = false
+	w.compressing = false
+	h := w.Header()
+	h.Del("Content-Encoding")
+	return true
+}
+
+// shouldCompress 根据视图函数设置的响应头判断要不要压缩
+func (w *compressWriter) shouldCompress() bool {
+	h := w.Header()
+	if h.Get("Content-Encoding") != "" || h.Get("Content-Range") != "" {
+		return false
+	}
+	switch w.Status() {
+	case http.StatusNoContent, http.StatusNotModified, http.StatusPartialContent:
+		return false
+	}
+	contentType := h.Get("Content-Type")
+	for _, t := range alreadyCompressedTypes {
+		if strings.HasPrefix(contentType, t) {
+			return false
+		}
+	}
+	return true
+}
+
+// decide 决定是否压缩，并把已经缓冲的数据写出去
+func (w *compressWriter) decide(compress bool) {
+	w.decided = true
+	w.compressing = compress
+	if compress {
+		h := w.Header()
+		h.Set("Content-Encoding", w.compressor.Encoding())
+		h.Del("Content-Length")
+		w.w = w.compressor.Writer(w.ResponseWriter)
+	}
+	if len(w.buf) > 0 {
+		if compress {
+			_, _ = w.w.Write(w.buf)
+		} else {
+			_, _ = w.ResponseWriter.Write(w.buf)
+		}
+		w.buf = w.buf[:0]
+	}
+}
+
+// close 视图函数执行完之后调用，发送剩余的数据
+func (w *compressWriter) close() {
+	if !w.decided {
+		// 响应体比 minLength 小，直接原样发送
+		w.decide(false)
+	}
+	if w.compressing {
+		_ = w.w.Close()
+		w.compressor.Release(w.w)
+		w.w = nil
+	}
+}
+
+// abort 视图函数 panic 时调用，丢弃缓冲的数据，归还压缩 Writer，不写入任何数据
+func (w *compressWriter) abort() {
+	w.buf = nil
+	if w.compressing {
+		w.compressor.Release(w.w)
+		w.w = nil
+		w.Header().Del("Content-Encoding")
+	}
+	w.decided = true
+	w.compressing = false
+}
@@ -1,43 +1,303 @@
 package neo
 
 import (
+	"context"
 	"encoding/json"
+	"encoding/xml"
+	"errors"
 	"fmt"
+	"io"
 	"math"
+	"mime"
+	"net"
 	"net/http"
+	"net/url"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
 )
 
 const abortIndex int = math.MaxInt >> 1
 
+// defaultMultipartMemory 解析 multipart/form-data 时最多使用的内存，超出部分写入临时文件
+const defaultMultipartMemory = 32 << 20
+
 type Context struct {
-	// 原始的请求和响应对象
-	Writer http.ResponseWriter
+	// 原始的请求和包装后的响应对象
+	Writer ResponseWriter
 	Req    *http.Request
+	// Writer 实际指向它，跟随 Context 一起复用
+	writermem responseWriter
 
 	// 当此请求方式
 	Method string
 	// 当此请求地址
 	URL string
 	// 请求参数 不需要暴露出去
-	params map[string]string
+	params Params
+	// 命中的路由 例如：/user/:id
+	fullPath string
 
 	// 需要执行的视图函数列表【包含中间件和命中的视图函数】中间件>视图函数
 	handlers []HandlerFunc
 	index    int // 控制上面视图函数列表的执行顺序， 默认是-1
 
 	T TemplateEngine // 模板引擎实例
+
+	engine *Engine // 当前请求所属的 Engine，独立创建的 Context 为 nil
+
+	// Errors 视图函数和中间件通过 Error 方法收集的错误，视图函数执行完后交给 Engine.ErrorHandler
+	Errors        ErrorList
+	errorsHandled bool
+
+	// Keys 中间件和视图函数之间传递的数据，通过 Set、Get 读写
+	Keys map[string]any
+	mu   sync.RWMutex // 保护 Keys
+
+	queryCache url.Values // 解析过的查询参数，第一次读取时解析
+	formParsed bool       // 是否已经解析过请求体中的表单
 }
 
+var _ context.Context = &Context{}
+
 func NewContext(w http.ResponseWriter, r *http.Request) *Context {
-	return &Context{
-		Writer:   w,
+	c := &Context{
 		Req:      r,
 		Method:   r.Method,
 		URL:      r.URL.Path,
-		params:   map[string]string{},
 		handlers: []HandlerFunc{},
 		index:    -1, // 默认是-1
 	}
+	c.writermem.reset(w)
+	c.Writer = &c.writermem
+	return c
+}
+
+// reset 重置上下文，供 Engine 从对象池中取出后复用
+// params 只截断长度，保留底层数组，避免每次请求重新分配
+func (c *Context) reset(w http.ResponseWriter, r *http.Request) {
+	c.writermem.reset(w)
+	c.Writer = &c.writermem
+	c.Req = r
+	c.Method = r.Method
+	c.URL = r.URL.Path
+	c.params = c.params[:0]
+	c.fullPath = ""
+	c.handlers = nil
+	c.index = -1
+	c.T = nil
+	c.engine = nil
+	c.Errors = c.Errors[:0]
+	c.errorsHandled = false
+	c.Keys = nil
+	c.queryCache = nil
+	c.formParsed = false
+}
+
+// Set 保存一个值，只在本次请求中有效 例如：认证中间件保存当前用户，视图函数再读取
+func (c *Context) Set(key string, value any) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.Keys == nil {
+		c.Keys = make(map[string]any)
+	}
+	c.Keys[key] = value
+}
+
+// Get 读取通过 Set 保存的值
+func (c *Context) Get(key string) (value any, exists bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	value, exists = c.Keys[key]
+	return
+}
+
+// MustGet 读取通过 Set 保存的值，不存在时 panic
+func (c *Context) MustGet(key string) any {
+	if value, exists := c.Get(key); exists {
+		return value
+	}
+	panic(fmt.Sprintf("web: ctx 中没有 %s", key))
+}
+
+// GetString 读取字符串，不存在或者类型不对时返回零值，下面的 GetXXX 都一样
+func (c *Context) GetString(key string) string {
+	value, _ := GetAs[string](c, key)
+	return value
+}
+
+func (c *Context) GetBool(key string) bool {
+	value, _ := GetAs[bool](c, key)
+	return value
+}
+
+func (c *Context) GetInt(key string) int {
+	value, _ := GetAs[int](c, key)
+	return value
+}
+
+func (c *Context) GetInt64(key string) int64 {
+	value, _ := GetAs[int64](c, key)
+	return value
+}
+
+func (c *Context) GetUint(key string) uint {
+	value, _ := GetAs[uint](c, key)
+	return value
+}
+
+func (c *Context) GetUint64(key string) uint64 {
+	value, _ := GetAs[uint64](c, key)
+	return value
+}
+
+func (c *Context) GetFloat64(key string) float64 {
+	value, _ := GetAs[float64](c, key)
+	return value
+}
+
+func (c *Context) GetTime(key string) time.Time {
+	value, _ := GetAs[time.Time](c, key)
+	return value
+}
+
+func (c *Context) GetDuration(key string) time.Duration {
+	value, _ := GetAs[time.Duration](c, key)
+	return value
+}
+
+func (c *Context) GetStringSlice(key string) []string {
+	value, _ := GetAs[[]string](c, key)
+	return value
+}
+
+func (c *Context) GetStringMap(key string) map[string]any {
+	value, _ := GetAs[map[string]any](c, key)
+	return value
+}
+
+func (c *Context) GetStringMapString(key string) map[string]string {
+	value, _ := GetAs[map[string]string](c, key)
+	return value
+}
+
+// GetAs 按照类型 T 读取通过 Set 保存的值，不存在或者类型不对时 ok 为 false
+// 例如：user, ok := neo.GetAs[*User](ctx, "user")
+func GetAs[T any](c *Context, key string) (value T, ok bool) {
+	raw, exists := c.Get(key)
+	if !exists {
+		return value, false
+	}
+	value, ok = raw.(T)
+	return value, ok
+}
+
+// MustGetAs 按照类型 T 读取通过 Set 保存的值，不存在或者类型不对时 panic
+func MustGetAs[T any](c *Context, key string) T {
+	value, ok := GetAs[T](c, key)
+	if !ok {
+		panic(fmt.Sprintf("web: ctx 中没有 %s 或者类型不是 %T", key, value))
+	}
+	return value
+}
+
+// Copy 返回当前 Context 的只读副本，副本不会放回对象池，可以安全地交给视图函数返回后还在运行的 goroutine
+// 副本包含请求、路由参数和 Keys，写响应不会有任何效果，也不能调用 Next
+// 例如：cp := ctx.Copy(); go func() { sendMail(cp, cp.GetString("user")) }()
+func (c *Context) Copy() *Context {
+	cp := &Context{
+		Req:      c.Req,
+		Method:   c.Method,
+		URL:      c.URL,
+		params:   append(Params(nil), c.params...),
+		fullPath: c.fullPath,
+		index:    abortIndex,
+		T:        c.T,
+		engine:   c.engine,
+	}
+	cp.writermem.reset(discardResponseWriter{header: http.Header{}})
+	cp.Writer = &cp.writermem
+	c.mu.RLock()
+	if c.Keys != nil {
+		cp.Keys = make(map[string]any, len(c.Keys))
+		for key, value := range c.Keys {
+			cp.Keys[key] = value
+		}
+	}
+	c.mu.RUnlock()
+	return cp
+}
+
+// discardResponseWriter 丢弃所有写入的数据，Copy 出来的副本使用它
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w discardResponseWriter) Header() http.Header {
+	return w.header
+}
+
+func (w discardResponseWriter) Write(data []byte) (int, error) {
+	return len(data), nil
+}
+
+func (w discardResponseWriter) WriteHeader(int) {}
+
+// Deadline 实现 context.Context，使用请求的 context
+// 这样 *Context 可以直接传给数据库、RPC 等需要 context.Context 的客户端
+// 请求结束后 Context 会放回对象池给其他请求复用，在视图函数返回后还会继续运行的 goroutine 中，
+// 必须使用 Copy 得到的副本或者 ctx.Req.Context()
+func (c *Context) Deadline() (deadline time.Time, ok bool) {
+	if c.Req == nil {
+		return
+	}
+	return c.Req.Context().Deadline()
+}
+
+// Done 实现 context.Context，客户端断开连接或者服务关闭时关闭
+func (c *Context) Done() <-chan struct{} {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Done()
+}
+
+// Err 实现 context.Context
+func (c *Context) Err() error {
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Err()
+}
+
+// Value 实现 context.Context，字符串类型的 key 先从 Keys 中查找，再从请求的 context 中查找
+func (c *Context) Value(key any) any {
+	if k, ok := key.(string); ok {
+		if value, exists := c.Get(k); exists {
+			return value
+		}
+	}
+	if c.Req == nil {
+		return nil
+	}
+	return c.Req.Context().Value(key)
+}
+
+// Error 收集一个错误，默认是 ErrorTypePrivate 类型，返回值可以继续设置类型和附加信息
+// 视图函数执行完之后，Engine.ErrorHandler 会根据收集到的错误统一生成响应
+func (c *Context) Error(err error) *Error {
+	if err == nil {
+		panic("web: ctx.Error 的参数不能为 nil")
+	}
+	var e *Error
+	if !errors.As(err, &e) {
+		e = &Error{Err: err, Type: ErrorTypePrivate}
+	}
+	c.Errors = append(c.Errors, e)
+	return e
 }
 
 // SetHeader 设置响应头
@@ -46,55 +306,559 @@ func (c *Context) SetHeader(key string, value string) {
 }
 
 // Status 设置响应状态码
+// 状态码会在写入响应体或者请求结束时才真正发送，在此之前都可以修改
 func (c *Context) Status(code int) {
 	c.Writer.WriteHeader(code)
 }
 
+// Render 使用渲染器 r 生成响应
+// 渲染失败时记录 ErrorTypeRender 错误，交给 Engine.ErrorHandler 统一处理
+func (c *Context) Render(code int, r Render) {
+	c.Status(code)
+	if !bodyAllowedForStatus(code) {
+		r.WriteContentType(c.Writer)
+		return
+	}
+	if err := r.Render(c.Writer); err != nil {
+		// 还没有写入响应体时撤销状态码，让 Engine.ErrorHandler 可以生成错误响应
+		if c.Writer.Size() == 0 {
+			c.Writer.Reset()
+		}
+		c.Error(err).SetType(ErrorTypeRender)
+	}
+}
+
 // HTML 返回HTML格式数据
 func (c *Context) HTML(code int, tplName string, data any) {
+	if c.T == nil {
+		c.Error(errors.New("web: 没有设置模板引擎")).SetType(ErrorTypeRender)
+		return
+	}
 	html, err := c.T.Render(c.Req.Context(), tplName, data)
 	if err != nil {
-		panic("Web: 解析模板失败")
+		// 渲染失败交给 Engine.ErrorHandler 统一处理
+		c.Error(err).SetType(ErrorTypeRender).SetMeta(tplName)
+		return
 	}
-	c.SetHeader("Context-Type", "text/html")
-	c.Status(code)
-	_, _ = c.Writer.Write(html) // 不用处理
+	c.Render(code, DataRender{ContentType: htmlContentType, Data: html})
 }
 
 // JSON 返回JSON格式树
-// JSON格式数据特殊点，需要给它先序列化
-func (c *Context) JSON(code int, data interface{}) {
-	c.SetHeader("Context-Type", "application/json")
-	c.Status(code)
-	// 序列化数据
-	encoder := json.NewEncoder(c.Writer)
-	if err := encoder.Encode(data); err != nil {
-		c.String(http.StatusInternalServerError, err.Error())
-		return
+// 先序列化到内存中，序列化失败时还没有写过状态码，交给 Engine.ErrorHandler 统一处理
+func (c *Context) JSON(code int, data any) {
+	c.Render(code, JSONRender{Data: data})
+}
+
+// IndentedJSON 返回带缩进的 JSON，比较耗费带宽，建议只在调试时使用
+func (c *Context) IndentedJSON(code int, data any) {
+	c.Render(code, IndentedJSONRender{Data: data})
+}
+
+// SecureJSON 返回 JSON，数据是数组时加上 DefaultSecureJSONPrefix 前缀，防止 JSON 劫持
+func (c *Context) SecureJSON(code int, data any) {
+	c.Render(code, SecureJSONRender{Prefix: DefaultSecureJSONPrefix, Data: data})
+}
+
+// JSONP 返回 JSONP，回调函数名从查询参数 callback 中读取，没有或者不是合法的函数名时返回普通 JSON
+func (c *Context) JSONP(code int, data any) {
+	c.Render(code, JSONPRender{Callback: c.Query("callback"), Data: data})
+}
+
+// AsciiJSON 返回只包含 ASCII 字符的 JSON
+func (c *Context) AsciiJSON(code int, data any) {
+	c.Render(code, AsciiJSONRender{Data: data})
+}
+
+// PureJSON 返回不转义 HTML 字符的 JSON
+func (c *Context) PureJSON(code int, data any) {
+	c.Render(code, PureJSONRender{Data: data})
+}
+
+// XML 返回XML格式数据
+func (c *Context) XML(code int, data any) {
+	c.Render(code, XMLRender{Data: data})
+}
+
+// YAML 返回YAML格式数据
+func (c *Context) YAML(code int, data any) {
+	c.Render(code, YAMLRender{Data: data})
+}
+
+// Data 原样返回 data
+func (c *Context) Data(code int, contentType string, data []byte) {
+	c.Render(code, DataRender{ContentType: contentType, Data: data})
+}
+
+// DataFromReader 把 reader 中的数据复制到响应体中，contentLength 小于 0 表示长度未知
+func (c *Context) DataFromReader(code int, contentLength int64, contentType string, reader io.Reader, extraHeaders map[string]string) {
+	c.Render(code, ReaderRender{
+		ContentType:   contentType,
+		ContentLength: contentLength,
+		Reader:        reader,
+		Headers:       extraHeaders,
+	})
+}
+
+// String 返回纯文本格式数据，没有 values 时 format 原样返回
+func (c *Context) String(code int, format string, values ...any) {
+	text := format
+	if len(values) > 0 {
+		text = fmt.Sprintf(format, values...)
 	}
+	c.Render(code, DataRender{ContentType: plainContentType, Data: []byte(text)})
 }
 
-// String 返回纯文本格式数据
-func (c *Context) String(code int, template string, value ...string) {
-	c.SetHeader("Context-Type", "text/plain")
-	c.Status(code)
-	c.Writer.Write([]byte(fmt.Sprintf(template, value)))
+// Negotiate ctx.Negotiate 的配置，Offered 是按照优先级排列的可以返回的格式
+// 各格式的数据没有设置时使用 Data
+type Negotiate struct {
+	Offered  []string
+	HTMLName string
+	HTMLData any
+	JSONData any
+	XMLData  any
+	YAMLData any
+	Data     any
+}
+
+// Negotiate 根据 Accept 请求头从 config.Offered 中选择响应格式
+// 支持 MIMEJSON、MIMEHTML、MIMEXML、MIMEXML2、MIMEYAML、MIMEPlain，没有可以接受的格式时返回 406
+func (c *Context) Negotiate(code int, config Negotiate) {
+	c.Writer.Header().Add("Vary", "Accept")
+	pick := func(data any) any {
+		if data != nil {
+			return data
+		}
+		return config.Data
+	}
+	switch c.NegotiateFormat(config.Offered...) {
+	case MIMEJSON:
+		c.JSON(code, pick(config.JSONData))
+	case MIMEHTML:
+		c.HTML(code, config.HTMLName, pick(config.HTMLData))
+	case MIMEXML, MIMEXML2:
+		c.XML(code, pick(config.XMLData))
+	case MIMEYAML:
+		c.YAML(code, pick(config.YAMLData))
+	case MIMEPlain:
+		c.String(code, fmt.Sprint(config.Data))
+	default:
+		c.Error(NewHTTPError(http.StatusNotAcceptable))
+		c.Abort()
+	}
+}
+
+// NegotiateFormat 根据 Accept 请求头从 offered 中选择最合适的格式，都不能接受时返回空字符串
+// 没有 Accept 请求头时返回 offered 中的第一个
+func (c *Context) NegotiateFormat(offered ...string) string {
+	if len(offered) == 0 {
+		panic("web: NegotiateFormat 至少需要一个格式")
+	}
+	accepts := parseAccept(c.Req.Header.Get("Accept"))
+	if len(accepts) == 0 {
+		return offered[0]
+	}
+	for _, accept := range accepts {
+		for _, format := range offered {
+			if matchMediaType(accept, format) {
+				return format
+			}
+		}
+	}
+	return ""
+}
+
+// parseAccept 解析 Accept 请求头，按照 q 值从大到小排列，q=0 的格式会被丢弃
+func parseAccept(header string) []string {
+	type mediaRange struct {
+		value string
+		q     float64
+	}
+	ranges := make([]mediaRange, 0)
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		value = strings.ToLower(strings.TrimSpace(value))
+		if value == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if key, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.TrimSpace(key) == "q" {
+				if f, err := strconv.ParseFloat(strings.TrimSpace(v), 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{value: value, q: q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool { return ranges[i].q > ranges[j].q })
+	result := make([]string, 0, len(ranges))
+	for _, r := range ranges {
+		result = append(result, r.value)
+	}
+	return result
+}
+
+// matchMediaType 判断 Accept 中的 accept 是否匹配 format，支持 */* 和 text/* 这种通配
+func matchMediaType(accept string, format string) bool {
+	if accept == "*/*" || accept == "*" {
+		return true
+	}
+	if strings.HasSuffix(accept, "/*") {
+		typ, _, _ := strings.Cut(format, "/")
+		return strings.EqualFold(strings.TrimSuffix(accept, "/*"), typ)
+	}
+	return strings.EqualFold(accept, format)
 }
 
 // Query 获取查询参数
 func (c *Context) Query(key string) string {
-	return c.Req.URL.Query().Get(key)
+	value, _ := c.GetQuery(key)
+	return value
+}
+
+// DefaultQuery 获取查询参数，参数不存在时返回 defaultValue；参数存在但是为空时返回空字符串
+func (c *Context) DefaultQuery(key string, defaultValue string) string {
+	if value, ok := c.GetQuery(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// GetQuery 获取查询参数，第二个返回值表示参数是否存在 例如：/user?name= 返回 ("", true)
+func (c *Context) GetQuery(key string) (string, bool) {
+	if values, ok := c.GetQueryArray(key); ok {
+		return values[0], true
+	}
+	return "", false
+}
+
+// QueryArray 获取同名的所有查询参数 例如：/user?id=1&id=2 返回 [1 2]
+func (c *Context) QueryArray(key string) []string {
+	values, _ := c.GetQueryArray(key)
+	return values
+}
+
+// GetQueryArray 获取同名的所有查询参数，第二个返回值表示参数是否存在
+func (c *Context) GetQueryArray(key string) ([]string, bool) {
+	values, ok := c.queryValues()[key]
+	return values, ok && len(values) > 0
+}
+
+// QueryMap 获取 key[xxx] 形式的查询参数 例如：/user?ids[a]=1&ids[b]=2 的 ids 返回 map[a:1 b:2]
+func (c *Context) QueryMap(key string) map[string]string {
+	dict, _ := c.GetQueryMap(key)
+	return dict
+}
+
+// GetQueryMap 获取 key[xxx] 形式的查询参数，第二个返回值表示是否至少有一个参数
+func (c *Context) GetQueryMap(key string) (map[string]string, bool) {
+	return valuesMap(c.queryValues(), key)
+}
+
+// queryValues 解析并缓存查询参数，同一个请求只解析一次
+func (c *Context) queryValues() url.Values {
+	if c.queryCache == nil {
+		c.queryCache = c.Req.URL.Query()
+	}
+	return c.queryCache
+}
+
+// valuesMap 从 values 中取出 key[xxx] 形式的参数
+func valuesMap(values map[string][]string, key string) (map[string]string, bool) {
+	dict := make(map[string]string)
+	exists := false
+	for k, v := range values {
+		if len(v) == 0 || !strings.HasPrefix(k, key+"[") || !strings.HasSuffix(k, "]") {
+			continue
+		}
+		name := k[len(key)+1 : len(k)-1]
+		if name == "" || strings.ContainsAny(name, "[]") {
+			continue
+		}
+		dict[name] = v[0]
+		exists = true
+	}
+	return dict, exists
 }
 
 // Params 获取请求参数，请求参数这里需要使用到动态路由再获取
 func (c *Context) Params(key string) string {
-	return c.params[key]
+	value, _ := c.params.Get(key)
+	return value
+}
+
+// ParamInt 把路由参数转换成 int，失败时返回 *ParamError，交给 Engine.ErrorHandler 会生成 400 响应
+// 例如：id, err := ctx.ParamInt("id")
+func (c *Context) ParamInt(key string) (int, error) {
+	value, ok := c.params.Get(key)
+	n, err := parseInt(ParamSourcePath, key, value, ok, strconv.IntSize)
+	return int(n), err
+}
+
+// ParamInt64 把路由参数转换成 int64，失败时返回 *ParamError
+func (c *Context) ParamInt64(key string) (int64, error) {
+	value, ok := c.params.Get(key)
+	return parseInt(ParamSourcePath, key, value, ok, 64)
+}
+
+// ParamUUID 校验路由参数是 UUID，返回小写的 UUID 字符串，失败时返回 *ParamError
+func (c *Context) ParamUUID(key string) (string, error) {
+	value, ok := c.params.Get(key)
+	if !ok {
+		return "", &ParamError{Source: ParamSourcePath, Key: key, Type: "uuid", Err: ErrParamMissing}
+	}
+	if !uuidRegexp.MatchString(value) {
+		return "", &ParamError{Source: ParamSourcePath, Key: key, Value: value, Type: "uuid", Err: errInvalidUUID}
+	}
+	return strings.ToLower(value), nil
+}
+
+// QueryInt 把查询参数转换成 int，参数不存在或者转换失败时返回 *ParamError
+func (c *Context) QueryInt(key string) (int, error) {
+	value, ok := c.GetQuery(key)
+	n, err := parseInt(ParamSourceQuery, key, value, ok, strconv.IntSize)
+	return int(n), err
+}
+
+// QueryInt64 把查询参数转换成 int64，参数不存在或者转换失败时返回 *ParamError
+func (c *Context) QueryInt64(key string) (int64, error) {
+	value, ok := c.GetQuery(key)
+	return parseInt(ParamSourceQuery, key, value, ok, 64)
+}
+
+var (
+	uuidRegexp     = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+	errInvalidUUID = errors.New("格式错误")
+)
+
+// parseInt 把参数转换成 bitSize 位的整数
+func parseInt(source string, key string, value string, exists bool, bitSize int) (int64, error) {
+	typ := "int" + strconv.Itoa(bitSize)
+	if !exists {
+		return 0, &ParamError{Source: source, Key: key, Type: typ, Err: ErrParamMissing}
+	}
+	n, err := strconv.ParseInt(value, 10, bitSize)
+	if err != nil {
+		// 只保留 ErrSyntax、ErrRange，去掉 strconv 重复的参数值
+		var numErr *strconv.NumError
+		if errors.As(err, &numErr) {
+			err = numErr.Err
+		}
+		return 0, &ParamError{Source: source, Key: key, Value: value, Type: typ, Err: err}
+	}
+	return n, nil
+}
+
+// FullPath 返回命中的路由 例如：/user/:id，没有命中路由时返回空字符串
+func (c *Context) FullPath() string {
+	return c.fullPath
+}
+
+// ClientIP 返回客户端 IP
+// 默认直接使用连接的远端地址；通过 WithTrustedProxies 设置了可信代理并且请求来自可信代理时，
+// 从右往左跳过 X-Forwarded-For 中的可信代理，返回第一个不可信的地址，没有时再读取 X-Real-IP
+func (c *Context) ClientIP() string {
+	remote := strings.TrimSpace(c.Req.RemoteAddr)
+	if host, _, err := net.SplitHostPort(remote); err == nil {
+		remote = host
+	}
+	remoteIP := net.ParseIP(remote)
+	if c.engine == nil || remoteIP == nil || !c.engine.isTrustedProxy(remoteIP) {
+		return remote
+	}
+	if forwarded := c.Req.Header.Get("X-Forwarded-For"); forwarded != "" {
+		addrs := strings.Split(forwarded, ",")
+		for i := len(addrs) - 1; i >= 0; i-- {
+			ip := net.ParseIP(strings.TrimSpace(addrs[i]))
+			if ip == nil {
+				break
+			}
+			if i == 0 || !c.engine.isTrustedProxy(ip) {
+				return ip.String()
+			}
+		}
+	}
+	if ip := net.ParseIP(strings.TrimSpace(c.Req.Header.Get("X-Real-IP"))); ip != nil {
+		return ip.String()
+	}
+	return remote
 }
 
 // PostForm 获取请求体数据
-// TODO 注意，根据用户传过来的数据格式的不同，获取数据的方式也是不同的。具体可以参考Gin
+// 需要按照数据格式解析整个请求体时，使用 Bind 系列方法
 func (c *Context) PostForm(key string) string {
-	return c.Req.FormValue(key)
+	value, _ := c.GetPostForm(key)
+	return value
+}
+
+// DefaultPostForm 获取请求体中的表单参数，参数不存在时返回 defaultValue
+func (c *Context) DefaultPostForm(key string, defaultValue string) string {
+	if value, ok := c.GetPostForm(key); ok {
+		return value
+	}
+	return defaultValue
+}
+
+// GetPostForm 获取请求体中的表单参数，第二个返回值表示参数是否存在
+func (c *Context) GetPostForm(key string) (string, bool) {
+	if values, ok := c.GetPostFormArray(key); ok {
+		return values[0], true
+	}
+	return "", false
+}
+
+// PostFormArray 获取请求体中同名的所有表单参数
+func (c *Context) PostFormArray(key string) []string {
+	values, _ := c.GetPostFormArray(key)
+	return values
+}
+
+// GetPostFormArray 获取请求体中同名的所有表单参数，第二个返回值表示参数是否存在
+func (c *Context) GetPostFormArray(key string) ([]string, bool) {
+	values, ok := c.postFormValues()[key]
+	return values, ok && len(values) > 0
+}
+
+// PostFormMap 获取请求体中 key[xxx] 形式的表单参数
+func (c *Context) PostFormMap(key string) map[string]string {
+	dict, _ := c.GetPostFormMap(key)
+	return dict
+}
+
+// GetPostFormMap 获取请求体中 key[xxx] 形式的表单参数，第二个返回值表示是否至少有一个参数
+func (c *Context) GetPostFormMap(key string) (map[string]string, bool) {
+	return valuesMap(c.postFormValues(), key)
+}
+
+// postFormValues 解析请求体中的表单，支持 application/x-www-form-urlencoded 和 multipart/form-data
+// 解析结果由 http.Request 缓存，同一个请求只解析一次
+func (c *Context) postFormValues() url.Values {
+	if !c.formParsed {
+		c.formParsed = true
+		if c.ContentType() == MIMEMultipartPOSTForm {
+			_ = c.Req.ParseMultipartForm(defaultMultipartMemory)
+		} else {
+			_ = c.Req.ParseForm()
+		}
+	}
+	return c.Req.PostForm
+}
+
+// ContentType 返回请求体格式，不包含 charset 等参数
+func (c *Context) ContentType() string {
+	contentType := c.Req.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err == nil {
+		return mediaType
+	}
+	mediaType, _, _ := strings.Cut(contentType, ";")
+	return strings.TrimSpace(mediaType)
+}
+
+// Bind 根据 Content-Type 选择解析方式，把请求数据绑定到 obj 上
+// JSON 和 XML 使用 json、xml 标签；表单和查询参数使用 form 标签
+func (c *Context) Bind(obj any) error {
+	switch c.ContentType() {
+	case MIMEJSON:
+		return c.BindJSON(obj)
+	case MIMEXML, MIMEXML2:
+		return c.BindXML(obj)
+	case MIMEMultipartPOSTForm:
+		return c.BindMultipartForm(obj)
+	default:
+		// application/x-www-form-urlencoded 以及没有请求体的请求
+		return c.BindForm(obj)
+	}
+}
+
+// BindJSON 把 JSON 格式的请求体绑定到 obj 上
+func (c *Context) BindJSON(obj any) error {
+	if c.Req.Body == nil {
+		return errEmptyBodyBind
+	}
+	if err := json.NewDecoder(c.Req.Body).Decode(obj); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errEmptyBodyBind
+		}
+		return err
+	}
+	return c.validate(obj)
+}
+
+// BindXML 把 XML 格式的请求体绑定到 obj 上
+func (c *Context) BindXML(obj any) error {
+	if c.Req.Body == nil {
+		return errEmptyBodyBind
+	}
+	if err := xml.NewDecoder(c.Req.Body).Decode(obj); err != nil {
+		if errors.Is(err, io.EOF) {
+			return errEmptyBodyBind
+		}
+		return err
+	}
+	return c.validate(obj)
+}
+
+// BindForm 把查询参数和 application/x-www-form-urlencoded 请求体绑定到 obj 上，使用 form 标签
+func (c *Context) BindForm(obj any) error {
+	if err := c.Req.ParseForm(); err != nil {
+		return err
+	}
+	return c.bindSource(obj, valuesSource(c.Req.Form, "form"))
+}
+
+// BindMultipartForm 把 multipart/form-data 请求体绑定到 obj 上，使用 form 标签
+// *multipart.FileHeader 和 []*multipart.FileHeader 类型的字段会绑定上传的文件
+func (c *Context) BindMultipartForm(obj any) error {
+	if err := c.Req.ParseMultipartForm(defaultMultipartMemory); err != nil {
+		return err
+	}
+	source := valuesSource(c.Req.Form, "form")
+	source.files = c.Req.MultipartForm.File
+	return c.bindSource(obj, source)
+}
+
+// BindQuery 只绑定查询参数，优先使用 query 标签，没有时使用 form 标签
+func (c *Context) BindQuery(obj any) error {
+	return c.bindSource(obj, valuesSource(c.queryValues(), "query", "form"))
+}
+
+// BindURI 绑定路由参数，使用 uri 标签
+// 例如路由 /user/:id 对应 `uri:"id"`
+func (c *Context) BindURI(obj any) error {
+	return c.bindSource(obj, paramsSource(c.params))
+}
+
+// BindHeader 绑定请求头，使用 header 标签，请求头名字不区分大小写
+func (c *Context) BindHeader(obj any) error {
+	return c.bindSource(obj, headerSource(c.Req.Header))
+}
+
+// MustBind 调用 Bind，失败时记录一个绑定错误并终止后续视图函数
+// 由 Engine.ErrorHandler 统一生成 400 响应，视图函数只需要判断返回值
+func (c *Context) MustBind(obj any) bool {
+	if err := c.Bind(obj); err != nil {
+		c.Error(err).SetType(ErrorTypeBind)
+		c.Abort()
+		return false
+	}
+	return true
+}
+
+func (c *Context) bindSource(obj any, source bindSource) error {
+	if err := mapForm(obj, source); err != nil {
+		return err
+	}
+	return c.validate(obj)
+}
+
+// validate 使用 Engine 上的校验器校验绑定好的数据
+func (c *Context) validate(obj any) error {
+	if c.engine == nil || c.engine.Validator == nil {
+		return nil
+	}
+	return c.engine.Validator.ValidateStruct(obj)
 }
 
 // Next 具体执行所有的视图函数
@@ -104,6 +868,20 @@ func (c *Context) Next() {
 	for ; c.index < size; c.index++ {
 		c.handlers[c.index](c)
 	}
+	// 第一次走到这里说明视图函数已经执行完了（或者被终止了），中间件的后半段还没有执行
+	// 在这里统一处理错误，Logger 等中间件就能拿到最终的状态码
+	if !c.errorsHandled {
+		c.errorsHandled = true
+		c.handleErrors()
+	}
+}
+
+// handleErrors 把收集到的错误交给 Engine.ErrorHandler
+func (c *Context) handleErrors() {
+	if len(c.Errors) == 0 || c.engine == nil || c.engine.ErrorHandler == nil {
+		return
+	}
+	c.engine.ErrorHandler(c, c.Errors)
 }
 
 func (c *Context) Abort() {
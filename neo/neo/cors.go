@@ -0,0 +1,138 @@
+package neo
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORSConfig 跨域中间件配置
+type CORSConfig struct {
+	// AllowOrigins 允许的来源，支持三种写法
+	// "*" 允许所有来源
+	// "https://example.com" 精确匹配
+	// "https://*.example.com" 通配匹配
+	AllowOrigins []string
+	// AllowOriginFunc 自定义来源判断，返回 true 表示允许，和 AllowOrigins 是或的关系
+	AllowOriginFunc func(origin string) bool
+	// AllowMethods 预检请求允许的请求方式，为空时使用常用的请求方式
+	AllowMethods []string
+	// AllowHeaders 预检请求允许的请求头，为空时原样返回浏览器请求的请求头
+	AllowHeaders []string
+	// ExposeHeaders 允许浏览器读取的响应头
+	ExposeHeaders []string
+	// AllowCredentials 是否允许携带 Cookie 等凭证，不能和 AllowOrigins 中的 "*" 同时使用
+	AllowCredentials bool
+	// MaxAge 预检请求结果的缓存时间，0 表示不设置
+	MaxAge time.Duration
+}
+
+// DefaultCORSConfig 允许所有来源的默认配置
+func DefaultCORSConfig() CORSConfig {
+	return CORSConfig{
+		AllowOrigins: []string{"*"},
+		AllowMethods: []string{
+			http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+			http.MethodDelete, http.MethodHead,
+		},
+		MaxAge: 12 * time.Hour,
+	}
+}
+
+// CORS 跨域中间件
+// 预检请求在这里直接应答 204 并终止后续视图函数；来源不被允许时返回 403
+// AllowOrigins 包含 "*" 同时开启 AllowCredentials 时直接 panic，否则任意网站都可以携带凭证读取响应
+func CORS(config CORSConfig) HandlerFunc {
+	allowAll := false
+	exact := make(map[string]struct{})
+	wildcards := make([][2]string, 0) // [前缀, 后缀]
+	for _, origin := range config.AllowOrigins {
+		if origin == "*" {
+			allowAll = true
+			continue
+		}
+		if i := strings.IndexByte(origin, '*'); i >= 0 {
+			wildcards = append(wildcards, [2]string{origin[:i], origin[i+1:]})
+			continue
+		}
+		exact[origin] = struct{}{}
+	}
+	if allowAll && config.AllowCredentials {
+		panic("web: CORS 的 AllowOrigins 包含 * 时不能开启 AllowCredentials，请列出具体的来源或者使用 AllowOriginFunc")
+	}
+	allowed := func(origin string) bool {
+		if allowAll {
+			return true
+		}
+		if _, ok := exact[origin]; ok {
+			return true
+		}
+		for _, w := range wildcards {
+			if len(origin) >= len(w[0])+len(w[1]) &&
+				strings.HasPrefix(origin, w[0]) && strings.HasSuffix(origin, w[1]) {
+				return true
+			}
+		}
+		return config.AllowOriginFunc != nil && config.AllowOriginFunc(origin)
+	}
+
+	methods := config.AllowMethods
+	if len(methods) == 0 {
+		methods = DefaultCORSConfig().AllowMethods
+	}
+	allowMethods := strings.Join(methods, ", ")
+	allowHeaders := strings.Join(config.AllowHeaders, ", ")
+	exposeHeaders := strings.Join(config.ExposeHeaders, ", ")
+	maxAge := ""
+	if config.MaxAge > 0 {
+		maxAge = strconv.FormatInt(int64(config.MaxAge/time.Second), 10)
+	}
+
+	return func(ctx *Context) {
+		origin := ctx.Req.Header.Get("Origin")
+		if origin == "" {
+			// 不是跨域请求
+			ctx.Next()
+			return
+		}
+		header := ctx.Writer.Header()
+		header.Add("Vary", "Origin")
+		if !allowed(origin) {
+			ctx.Status(http.StatusForbidden)
+			ctx.Abort()
+			return
+		}
+		if allowAll {
+			header.Set("Access-Control-Allow-Origin", "*")
+		} else {
+			header.Set("Access-Control-Allow-Origin", origin)
+		}
+		if config.AllowCredentials {
+			header.Set("Access-Control-Allow-Credentials", "true")
+		}
+
+		// 预检请求
+		if ctx.Method == http.MethodOptions && ctx.Req.Header.Get("Access-Control-Request-Method") != "" {
+			header.Add("Vary", "Access-Control-Request-Method")
+			header.Add("Vary", "Access-Control-Request-Headers")
+			header.Set("Access-Control-Allow-Methods", allowMethods)
+			if allowHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", allowHeaders)
+			} else if reqHeaders := ctx.Req.Header.Get("Access-Control-Request-Headers"); reqHeaders != "" {
+				header.Set("Access-Control-Allow-Headers", reqHeaders)
+			}
+			if maxAge != "" {
+				header.Set("Access-Control-Max-Age", maxAge)
+			}
+			ctx.Status(http.StatusNoContent)
+			ctx.Abort()
+			return
+		}
+
+		if exposeHeaders != "" {
+			header.Set("Access-Control-Expose-Headers", exposeHeaders)
+		}
+		ctx.Next()
+	}
+}
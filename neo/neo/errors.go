@@ -0,0 +1,177 @@
+package neo
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ErrorType 错误类型，可以按位组合
+type ErrorType uint8
+
+const (
+	ErrorTypePrivate ErrorType = 1 << iota // 内部错误，信息不会返回给客户端，默认
+	ErrorTypePublic                        // 公开错误，信息可以直接返回给客户端
+	ErrorTypeBind                          // 绑定或者校验请求数据失败
+	ErrorTypeRender                        // 渲染响应失败
+
+	ErrorTypeAny ErrorType = 1<<8 - 1 // 匹配任意类型
+)
+
+// Error 收集在 Context 上的错误
+type Error struct {
+	Err  error
+	Type ErrorType
+	Meta any // 附加信息
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// SetType 设置错误类型
+func (e *Error) SetType(t ErrorType) *Error {
+	e.Type = t
+	return e
+}
+
+// SetMeta 设置附加信息
+func (e *Error) SetMeta(meta any) *Error {
+	e.Meta = meta
+	return e
+}
+
+// IsType 错误是否属于类型 t
+func (e *Error) IsType(t ErrorType) bool {
+	return e.Type&t > 0
+}
+
+// ErrorList 一次请求中收集到的所有错误
+type ErrorList []*Error
+
+// Last 返回最后一个错误，没有错误时返回 nil
+func (list ErrorList) Last() *Error {
+	if len(list) == 0 {
+		return nil
+	}
+	return list[len(list)-1]
+}
+
+// ByType 返回属于类型 t 的错误
+func (list ErrorList) ByType(t ErrorType) ErrorList {
+	result := make(ErrorList, 0)
+	for _, e := range list {
+		if e.IsType(t) {
+			result = append(result, e)
+		}
+	}
+	return result
+}
+
+func (list ErrorList) String() string {
+	messages := make([]string, 0, len(list))
+	for _, e := range list {
+		messages = append(messages, e.Error())
+	}
+	return strings.Join(messages, "; ")
+}
+
+// HTTPError 带有状态码的错误，ErrorHandler 会使用它的状态码和信息作为响应
+type HTTPError struct {
+	Code    int
+	Message string
+}
+
+// NewHTTPError 创建 HTTPError，没有传入 message 时使用状态码对应的默认信息
+func NewHTTPError(code int, message ...string) *HTTPError {
+	e := &HTTPError{Code: code, Message: http.StatusText(code)}
+	if len(message) > 0 {
+		e.Message = message[0]
+	}
+	return e
+}
+
+func (e *HTTPError) Error() string {
+	return e.Message
+}
+
+// 参数的来源
+const (
+	ParamSourcePath  = "path"
+	ParamSourceQuery = "query"
+)
+
+// ErrParamMissing 参数不存在
+var ErrParamMissing = errors.New("缺少参数")
+
+// ParamError 路由参数或者查询参数转换失败，ErrorHandler 会返回 400
+type ParamError struct {
+	Source string // 参数的来源 ParamSourcePath 或者 ParamSourceQuery
+	Key    string
+	Value  string
+	Type   string // 期望的类型 例如：int、uuid
+	Err    error
+}
+
+func (e *ParamError) Error() string {
+	if errors.Is(e.Err, ErrParamMissing) {
+		return fmt.Sprintf("%s 参数 %s: %v", e.Source, e.Key, e.Err)
+	}
+	return fmt.Sprintf("%s 参数 %s=%q 不是合法的 %s: %v", e.Source, e.Key, e.Value, e.Type, e.Err)
+}
+
+func (e *ParamError) Unwrap() error {
+	return e.Err
+}
+
+// HandlerFuncE 返回错误的视图函数
+type HandlerFuncE func(ctx *Context) error
+
+// E 把返回错误的视图函数转换成 HandlerFunc，返回的错误会收集到 ctx.Errors 中，
+// 由 Engine.ErrorHandler 统一生成响应
+func E(fn HandlerFuncE) HandlerFunc {
+	return func(ctx *Context) {
+		if err := fn(ctx); err != nil {
+			ctx.Error(err)
+			ctx.Abort()
+		}
+	}
+}
+
+// errorResponse 默认错误响应的格式
+type errorResponse struct {
+	Error   string `json:"error"`
+	Details any    `json:"details,omitempty"`
+}
+
+// DefaultErrorHandler 默认的错误处理
+// 视图函数已经写过响应时什么都不做；否则根据最后一个错误生成 JSON 响应：
+// HTTPError 使用它自己的状态码，参数错误和绑定错误返回 400，公开错误返回 500 和错误信息，其他返回 500
+func DefaultErrorHandler(ctx *Context, errs ErrorList) {
+	if ctx.Writer.Written() {
+		return
+	}
+	last := errs.Last()
+	var httpErr *HTTPError
+	var validationErrs ValidationErrors
+	var paramErr *ParamError
+	switch {
+	case errors.As(last, &httpErr):
+		ctx.JSON(httpErr.Code, errorResponse{Error: httpErr.Message})
+	case errors.As(last, &validationErrs):
+		ctx.JSON(http.StatusBadRequest, errorResponse{Error: "参数校验失败", Details: validationErrs})
+	case errors.As(last, &paramErr):
+		ctx.JSON(http.StatusBadRequest, errorResponse{Error: paramErr.Error()})
+	case last.IsType(ErrorTypeBind):
+		ctx.JSON(http.StatusBadRequest, errorResponse{Error: last.Error()})
+	case last.IsType(ErrorTypePublic):
+		ctx.JSON(http.StatusInternalServerError, errorResponse{Error: last.Error()})
+	default:
+		ctx.JSON(http.StatusInternalServerError, errorResponse{Error: http.StatusText(http.StatusInternalServerError)})
+	}
+}
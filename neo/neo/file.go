@@ -1,11 +1,23 @@
 package neo
 
 import (
-	"io/ioutil"
+	"errors"
+	"fmt"
+	"html"
+	"io/fs"
+	"mime"
 	"net/http"
+	"net/url"
+	"path"
 	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
 )
 
+// StaticFile 把 Dir 目录开放出去，文件名从路由参数 Path 中读取
+// 例如：engine.GET("/assets/*filepath", NewStaticFile("./static", "filepath").Handler())
+// 更推荐直接使用 RouterGroup.Static
 type StaticFile struct {
 	Dir  string // 需要开放的文件路径
 	Path string // 参数地址
@@ -16,16 +28,266 @@ func NewStaticFile(dir string, path string) *StaticFile {
 }
 
 func (s *StaticFile) Handler() HandlerFunc {
+	handler := newStaticHandler(http.Dir(s.Dir))
 	return func(ctx *Context) {
-		// 拿到URL中的文件名
-		fileName := ctx.Params(s.Path)
-		// 拼接文件地址并打开
-		filePath := filepath.Join(s.Dir, fileName)
-		data, err := ioutil.ReadFile(filePath)
-		if err != nil {
-			ctx.String(http.StatusInternalServerError, "服务器异常")
+		// 拿到URL中的文件名，serve 保证不会跳出 Dir 目录
+		handler.serve(ctx, ctx.Params(s.Path))
+	}
+}
+
+// precompressedEncoding 预压缩文件的编码和后缀
+type precompressedEncoding struct {
+	encoding  string
+	extension string
+}
+
+// staticHandler 静态文件服务的配置
+type staticHandler struct {
+	fileSystem    http.FileSystem
+	index         string                  // 目录的默认文件，为空表示不使用
+	listing       bool                    // 没有默认文件时是否列出目录内容
+	precompressed []precompressedEncoding // 按照优先级排列的预压缩格式
+	fallback      string                  // 文件不存在时返回的文件，用于单页应用
+}
+
+func newStaticHandler(fileSystem http.FileSystem) *staticHandler {
+	return &staticHandler{fileSystem: fileSystem, index: "index.html"}
+}
+
+// StaticOption 静态文件服务的可选配置
+type StaticOption func(h *staticHandler)
+
+// WithIndexFile 设置目录的默认文件，默认是 index.html，传入空字符串表示不使用默认文件
+func WithIndexFile(name string) StaticOption {
+	return func(h *staticHandler) {
+		h.index = name
+	}
+}
+
+// WithDirectoryListing 目录没有默认文件时列出目录内容，默认返回 404
+func WithDirectoryListing() StaticOption {
+	return func(h *staticHandler) {
+		h.listing = true
+	}
+}
+
+// WithPrecompressed 客户端支持时优先返回预先压缩好的 .br、.gz 文件
+// 例如请求 app.js 且 Accept-Encoding 包含 br 时，如果存在 app.js.br 就直接返回它
+func WithPrecompressed() StaticOption {
+	return func(h *staticHandler) {
+		h.precompressed = []precompressedEncoding{
+			{encoding: "br", extension: ".br"},
+			{encoding: "gzip", extension: ".gz"},
+		}
+	}
+}
+
+// WithSPAFallback 请求的文件不存在时返回 file，用于前端路由的单页应用
+// 例如：engine.Static("/app", "./dist", neo.WithSPAFallback("index.html"))
+func WithSPAFallback(file string) StaticOption {
+	return func(h *staticHandler) {
+		h.fallback = path.Clean("/" + file)
+	}
+}
+
+// Static 把本地目录 root 挂载到 prefix 下
+// 例如：engine.Static("/assets", "./static")，请求 /assets/css/neo.css 返回 ./static/css/neo.css
+func (group *RouterGroup) Static(prefix string, root string, opts ...StaticOption) {
+	group.StaticFS(prefix, http.Dir(root), opts...)
+}
+
+// StaticFS 把任意 http.FileSystem 挂载到 prefix 下
+// embed.FS 可以通过 http.FS 转换，例如：engine.StaticFS("/assets", http.FS(assets))
+func (group *RouterGroup) StaticFS(prefix string, fileSystem http.FileSystem, opts ...StaticOption) {
+	if strings.ContainsAny(prefix, ":*{") {
+		panic(fmt.Sprintf("web: 静态文件路由 %s 不能包含参数", prefix))
+	}
+	handler := newStaticHandler(fileSystem)
+	for _, opt := range opts {
+		opt(handler)
+	}
+	pattern := path.Join(prefix, "/*filepath")
+	group.GET(pattern, func(ctx *Context) {
+		handler.serve(ctx, ctx.Params("filepath"))
+	})
+}
+
+// StaticFile 把单个本地文件注册到 relativePath 上 例如：engine.StaticFile("/favicon.ico", "./static/favicon.ico")
+func (group *RouterGroup) StaticFile(relativePath string, file string, opts ...StaticOption) {
+	if strings.ContainsAny(relativePath, ":*{") {
+		panic(fmt.Sprintf("web: 静态文件路由 %s 不能包含参数", relativePath))
+	}
+	handler := newStaticHandler(http.Dir(filepath.Dir(file)))
+	for _, opt := range opts {
+		opt(handler)
+	}
+	name := filepath.Base(file)
+	group.GET(relativePath, func(ctx *Context) {
+		handler.serve(ctx, name)
+	})
+}
+
+// serve 从文件系统中读取 name 文件并返回
+// name 会先按照根目录清理，.. 无法跳出根目录；Range、If-Modified-Since、If-None-Match 等交给 http.ServeContent 处理
+func (h *staticHandler) serve(ctx *Context, name string) {
+	name = path.Clean("/" + name)
+	f, err := h.fileSystem.Open(name)
+	if err != nil {
+		h.serveError(ctx, err)
+		return
+	}
+	defer func() { _ = f.Close() }()
+	info, err := f.Stat()
+	if err != nil {
+		h.serveError(ctx, err)
+		return
+	}
+	if info.IsDir() {
+		h.serveDir(ctx, f, name)
+		return
+	}
+	h.serveContent(ctx, f, name, info)
+}
+
+// serveDir 目录优先返回默认文件，其次是目录列表
+func (h *staticHandler) serveDir(ctx *Context, dir http.File, name string) {
+	// 和 http.FileServer 一样，目录必须以 / 结尾，否则页面中的相对路径会出错
+	if !strings.HasSuffix(ctx.Req.URL.Path, "/") {
+		// 使用相对地址，请求地址是 //evil.com 这种形式时，绝对地址会变成跳转到其他网站
+		target := path.Base(ctx.Req.URL.Path) + "/"
+		if ctx.Req.URL.RawQuery != "" {
+			target += "?" + ctx.Req.URL.RawQuery
+		}
+		ctx.SetHeader("Location", target)
+		ctx.Status(http.StatusMovedPermanently)
+		return
+	}
+	if h.index != "" {
+		indexName := path.Join(name, h.index)
+		if f, err := h.fileSystem.Open(indexName); err == nil {
+			defer func() { _ = f.Close() }()
+			if info, err := f.Stat(); err == nil && !info.IsDir() {
+				h.serveContent(ctx, f, indexName, info)
+				return
+			}
+		}
+	}
+	if !h.listing {
+		h.serveError(ctx, fs.ErrNotExist)
+		return
+	}
+	entries, err := dir.Readdir(-1)
+	if err != nil {
+		h.serveError(ctx, err)
+		return
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].Name() < entries[j].Name() })
+	var b strings.Builder
+	b.WriteString("<!doctype html>\n<meta name=\"viewport\" content=\"width=device-width\">\n<pre>\n")
+	for _, entry := range entries {
+		entryName := entry.Name()
+		if entry.IsDir() {
+			entryName += "/"
+		}
+		href := url.URL{Path: entryName}
+		fmt.Fprintf(&b, "<a href=\"%s\">%s</a>\n", href.String(), html.EscapeString(entryName))
+	}
+	b.WriteString("</pre>\n")
+	ctx.SetHeader("Content-Type", "text/html; charset=utf-8")
+	ctx.Status(http.StatusOK)
+	_, _ = ctx.Writer.Write([]byte(b.String()))
+}
+
+// serveContent 返回单个文件，客户端支持时优先返回预压缩的文件
+func (h *staticHandler) serveContent(ctx *Context, f http.File, name string, info fs.FileInfo) {
+	if len(h.precompressed) > 0 {
+		ctx.Writer.Header().Add("Vary", "Accept-Encoding")
+		acceptEncoding := ctx.Req.Header.Get("Accept-Encoding")
+		for _, p := range h.precompressed {
+			if !acceptsEncoding(acceptEncoding, p.encoding) {
+				continue
+			}
+			cf, err := h.fileSystem.Open(name + p.extension)
+			if err != nil {
+				continue
+			}
+			cinfo, err := cf.Stat()
+			if err != nil || cinfo.IsDir() {
+				_ = cf.Close()
+				continue
+			}
+			// 压缩文件的类型按照原始文件计算，避免 ServeContent 把它识别成压缩包
+			contentType := mime.TypeByExtension(path.Ext(name))
+			if contentType == "" {
+				contentType = "application/octet-stream"
+			}
+			ctx.SetHeader("Content-Type", contentType)
+			ctx.SetHeader("Content-Encoding", p.encoding)
+			ctx.SetHeader("ETag", fileETag(cinfo, p.encoding))
+			http.ServeContent(ctx.Writer, ctx.Req, info.Name(), cinfo.ModTime(), cf)
+			_ = cf.Close()
 			return
 		}
-		ctx.String(http.StatusOK, string(data))
 	}
+	ctx.SetHeader("ETag", fileETag(info, ""))
+	http.ServeContent(ctx.Writer, ctx.Req, info.Name(), info.ModTime(), f)
+}
+
+// serveError 文件不存在时优先返回单页应用的兜底文件，否则转换成 404、403 或者 500
+// 错误会记录到 ctx.Errors，由 Engine.ErrorHandler 生成响应；ErrorHandler 为 nil 时直接返回纯文本
+func (h *staticHandler) serveError(ctx *Context, err error) {
+	if h.fallback != "" && errors.Is(err, fs.ErrNotExist) {
+		if f, openErr := h.fileSystem.Open(h.fallback); openErr == nil {
+			defer func() { _ = f.Close() }()
+			if info, statErr := f.Stat(); statErr == nil && !info.IsDir() {
+				h.serveContent(ctx, f, h.fallback, info)
+				return
+			}
+		}
+	}
+	code := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		code = http.StatusNotFound
+	case errors.Is(err, fs.ErrPermission):
+		code = http.StatusForbidden
+	}
+	ctx.Error(NewHTTPError(code)).SetMeta(err)
+	// 没有 ErrorHandler 时错误不会变成响应，这里直接返回状态码
+	if ctx.engine == nil || ctx.engine.ErrorHandler == nil {
+		ctx.String(code, http.StatusText(code))
+	}
+	ctx.Abort()
+}
+
+// fileETag 根据修改时间和大小生成弱 ETag，预压缩的文件带上编码区分
+func fileETag(info fs.FileInfo, encoding string) string {
+	if encoding != "" {
+		return fmt.Sprintf(`W/"%x-%x-%s"`, info.ModTime().UnixNano(), info.Size(), encoding)
+	}
+	return fmt.Sprintf(`W/"%x-%x"`, info.ModTime().UnixNano(), info.Size())
+}
+
+// acceptsEncoding 判断 Accept-Encoding 是否接受 encoding，q=0 表示明确拒绝
+func acceptsEncoding(acceptEncoding string, encoding string) bool {
+	accepted := false
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		name, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		name = strings.TrimSpace(name)
+		if !strings.EqualFold(name, encoding) && name != "*" {
+			continue
+		}
+		q := 1.0
+		if key, value, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(key) == "q" {
+			if f, err := strconv.ParseFloat(strings.TrimSpace(value), 64); err == nil {
+				q = f
+			}
+		}
+		if strings.EqualFold(name, encoding) {
+			// 明确写出的编码优先于 *
+			return q > 0
+		}
+		accepted = q > 0
+	}
+	return accepted
 }
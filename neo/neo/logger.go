@@ -0,0 +1,166 @@
+package neo
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// LogFormat 访问日志格式
+type LogFormat int
+
+const (
+	LogFormatText     LogFormat = iota // 便于阅读的文本格式，默认
+	LogFormatJSON                      // 每行一个 JSON 对象，方便日志系统采集
+	LogFormatCombined                  // Apache combined 格式
+)
+
+// LogEntry 一条访问日志
+type LogEntry struct {
+	Time      time.Time     `json:"time"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`  // 请求地址 例如：/user/1
+	Route     string        `json:"route"` // 命中的路由 例如：/user/:id，没有命中时为空
+	Query     string        `json:"query,omitempty"`
+	Proto     string        `json:"proto"`
+	Status    int           `json:"status"`
+	Latency   time.Duration `json:"latency_ns"`
+	Size      int           `json:"size"`
+	ClientIP  string        `json:"client_ip"`
+	UserAgent string        `json:"user_agent"`
+	Referer   string        `json:"referer,omitempty"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// LogSink 访问日志的输出目标
+// 对接 slog、zap 等结构化日志库时，实现这个接口把 LogEntry 的字段转换成对应的键值对即可
+type LogSink interface {
+	Log(entry LogEntry)
+}
+
+// LogSinkFunc 函数形式的 LogSink
+type LogSinkFunc func(entry LogEntry)
+
+func (f LogSinkFunc) Log(entry LogEntry) {
+	f(entry)
+}
+
+// NewWriterSink 按照 format 格式化日志并写入 w，并发写入时保证每条日志完整
+func NewWriterSink(w io.Writer, format LogFormat) LogSink {
+	return &writerSink{w: w, format: format}
+}
+
+type writerSink struct {
+	mu     sync.Mutex
+	w      io.Writer
+	format LogFormat
+}
+
+func (s *writerSink) Log(entry LogEntry) {
+	var line []byte
+	switch s.format {
+	case LogFormatJSON:
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return
+		}
+		line = append(data, '\n')
+	case LogFormatCombined:
+		uri := entry.Path
+		if entry.Query != "" {
+			uri += "?" + entry.Query
+		}
+		line = []byte(fmt.Sprintf("%s - - [%s] \"%s %s %s\" %d %d \"%s\" \"%s\"\n",
+			entry.ClientIP, entry.Time.Format("02/Jan/2006:15:04:05 -0700"),
+			entry.Method, uri, entry.Proto, entry.Status, entry.Size,
+			dashIfEmpty(entry.Referer), dashIfEmpty(entry.UserAgent)))
+	default:
+		route := entry.Route
+		if route == "" {
+			route = "-"
+		}
+		line = []byte(fmt.Sprintf("[NEO] %s | %3d | %13v | %15s | %-7s %s (%s) | %dB | %s\n",
+			entry.Time.Format("2006/01/02 - 15:04:05"), entry.Status, entry.Latency,
+			entry.ClientIP, entry.Method, entry.Path, route, entry.Size, dashIfEmpty(entry.RequestID)))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	_, _ = s.w.Write(line)
+}
+
+func dashIfEmpty(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// LoggerConfig 访问日志中间件配置
+type LoggerConfig struct {
+	// Format 日志格式，Sink 为空时生效
+	Format LogFormat
+	// Output 日志写入的位置，默认是 os.Stdout，Sink 为空时生效
+	Output io.Writer
+	// Sink 自定义日志输出，设置后 Format 和 Output 不再生效
+	Sink LogSink
+	// SkipPaths 不记录日志的请求地址，精确匹配 例如：/healthz
+	SkipPaths []string
+	// Skip 返回 true 时不记录日志
+	Skip func(ctx *Context) bool
+	// RequestIDHeader 读取请求 ID 的请求头，默认是 X-Request-ID
+	RequestIDHeader string
+}
+
+// Logger 访问日志中间件，在所有视图函数执行完之后记录一条日志
+func Logger(config LoggerConfig) HandlerFunc {
+	sink := config.Sink
+	if sink == nil {
+		output := config.Output
+		if output == nil {
+			output = os.Stdout
+		}
+		sink = NewWriterSink(output, config.Format)
+	}
+	skipPaths := make(map[string]struct{}, len(config.SkipPaths))
+	for _, path := range config.SkipPaths {
+		skipPaths[path] = struct{}{}
+	}
+	requestIDHeader := config.RequestIDHeader
+	if requestIDHeader == "" {
+		requestIDHeader = "X-Request-ID"
+	}
+
+	return func(ctx *Context) {
+		start := time.Now()
+		ctx.Next()
+
+		if _, ok := skipPaths[ctx.URL]; ok {
+			return
+		}
+		if config.Skip != nil && config.Skip(ctx) {
+			return
+		}
+		requestID := ctx.Req.Header.Get(requestIDHeader)
+		if requestID == "" {
+			requestID = ctx.Writer.Header().Get(requestIDHeader)
+		}
+		sink.Log(LogEntry{
+			Time:      start,
+			Method:    ctx.Method,
+			Path:      ctx.URL,
+			Route:     ctx.FullPath(),
+			Query:     ctx.Req.URL.RawQuery,
+			Proto:     ctx.Req.Proto,
+			Status:    ctx.Writer.Status(),
+			Latency:   time.Since(start),
+			Size:      ctx.Writer.Size(),
+			ClientIP:  ctx.ClientIP(),
+			UserAgent: ctx.Req.UserAgent(),
+			Referer:   ctx.Req.Referer(),
+			RequestID: requestID,
+		})
+	}
+}
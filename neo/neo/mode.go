@@ -0,0 +1,99 @@
+package neo
+
+import (
+	"log"
+	"os"
+	"reflect"
+	"runtime"
+	"sort"
+	"strings"
+)
+
+// Mode 运行模式，控制框架自身的日志输出
+type Mode string
+
+const (
+	DebugMode   Mode = "debug"   // 开发模式，打印路由注册等调试信息，默认
+	ReleaseMode Mode = "release" // 生产模式，框架不输出调试信息
+	TestMode    Mode = "test"    // 测试模式，和生产模式一样不输出调试信息
+)
+
+// EnvNeoMode 没有通过 WithMode 指定时，从这个环境变量读取运行模式
+const EnvNeoMode = "NEO_MODE"
+
+// WithMode 指定运行模式
+func WithMode(mode Mode) EngineOption {
+	return func(engine *Engine) {
+		engine.mode = mode
+	}
+}
+
+// defaultMode 读取环境变量中的运行模式，无法识别时使用 DebugMode
+func defaultMode() Mode {
+	switch mode := Mode(os.Getenv(EnvNeoMode)); mode {
+	case ReleaseMode, TestMode:
+		return mode
+	}
+	return DebugMode
+}
+
+// Mode 返回当前的运行模式
+func (e *Engine) Mode() Mode {
+	return e.mode
+}
+
+// IsDebugging 是否是开发模式
+func (e *Engine) IsDebugging() bool {
+	return e.mode == DebugMode
+}
+
+// debugPrint 只在开发模式下输出框架日志
+func (e *Engine) debugPrint(format string, values ...any) {
+	if !e.IsDebugging() {
+		return
+	}
+	if !strings.HasSuffix(format, "\n") {
+		format += "\n"
+	}
+	log.Printf("[NEO-debug] "+format, values...)
+}
+
+// RouteInfo 一条已注册路由的信息
+type RouteInfo struct {
+	Method      string `json:"method"`
+	Path        string `json:"path"`           // 完整的路由 例如：/v1/user/:id
+	Name        string `json:"name,omitempty"` // 通过 Route.Name 设置的名字
+	Handler     string `json:"handler"`        // 视图函数的名字 例如：main.getUser
+	Middlewares int    `json:"middlewares"`    // 视图函数之前的中间件数量，包括路由组中间件和路由中间件
+}
+
+// Routes 返回所有已注册的路由，按照路由和请求方式排序
+func (e *Engine) Routes() []RouteInfo {
+	names := make(map[string]string, len(e.namedRoutes))
+	for name, named := range e.namedRoutes {
+		names[named.pattern] = name
+	}
+	routes := make([]RouteInfo, 0)
+	for method, root := range e.router.roots {
+		root.walk(func(n *node) {
+			routes = append(routes, RouteInfo{
+				Method:      method,
+				Path:        n.pattern,
+				Name:        names[n.pattern],
+				Handler:     nameOfFunction(n.handlers[len(n.handlers)-1]),
+				Middlewares: len(n.handlers) - 1,
+			})
+		})
+	}
+	sort.Slice(routes, func(i, j int) bool {
+		if routes[i].Path != routes[j].Path {
+			return routes[i].Path < routes[j].Path
+		}
+		return routes[i].Method < routes[j].Method
+	})
+	return routes
+}
+
+func nameOfFunction(f any) string {
+	return runtime.FuncForPC(reflect.ValueOf(f).Pointer()).Name()
+}
@@ -2,9 +2,11 @@ package neo
 
 import (
 	"fmt"
-	"log"
+	"net"
 	"net/http"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type H map[string]string
@@ -15,53 +17,226 @@ type HandlerFunc func(ctx *Context)
 // 因为模板引擎不是一个很常用的功能，所以我们这里做成一个可选的功能
 type TemplateOption func(engine *Engine)
 
+// WithTemplateOnEngine 设置模板引擎，支持的模板引擎会跟随 Engine 的运行模式，例如开发模式下开启热加载
+// GoTemplateEngine 设置之后，模板中可以通过 url 函数生成命名路由的地址
 func WithTemplateOnEngine(engine *Engine, opts ...TemplateOption) {
 	for _, opt := range opts {
 		opt(engine)
 	}
+	if t, ok := engine.T.(engineAware); ok {
+		t.bindEngine(engine)
+	}
+}
+
+// WithTemplate 设置默认的模板引擎，没有匹配到后缀和前缀的模板都交给它渲染
+func WithTemplate(t TemplateEngine) TemplateOption {
+	return func(engine *Engine) {
+		engine.templateRegistry().SetDefault(t)
+	}
+}
+
+// WithTemplateExtension 后缀是 ext 的模板交给 t 渲染 例如：WithTemplateExtension(".tmpl", textEngine)
+func WithTemplateExtension(ext string, t TemplateEngine) TemplateOption {
+	return func(engine *Engine) {
+		engine.templateRegistry().RegisterExtension(ext, t)
+	}
+}
+
+// WithTemplatePrefix 名字以 prefix 开头的模板交给 t 渲染 例如：WithTemplatePrefix("emails/", textEngine)
+func WithTemplatePrefix(prefix string, t TemplateEngine) TemplateOption {
+	return func(engine *Engine) {
+		engine.templateRegistry().RegisterPrefix(prefix, t)
+	}
+}
+
+// templateRegistry 返回 Engine 上的模板注册表，之前直接设置的模板引擎作为默认模板引擎
+func (e *Engine) templateRegistry() *TemplateRegistry {
+	if registry, ok := e.T.(*TemplateRegistry); ok {
+		return registry
+	}
+	registry := NewTemplateRegistry()
+	registry.SetDefault(e.T)
+	e.T = registry
+	return registry
+}
+
+// EngineOption 创建Engine时的可选配置
+type EngineOption func(engine *Engine)
+
+// WithAutoOptions 开启后，OPTIONS 请求没有注册路由时，框架会根据该路径已注册的请求方式自动应答
+// 响应状态码是 204，Allow 响应头列出所有可用的请求方式
+func WithAutoOptions() EngineOption {
+	return func(engine *Engine) {
+		engine.router.autoOptions = true
+	}
+}
+
+// WithResponseBuffer 开启后，所有响应都先缓冲在内存中，请求结束时再发送
+// 这样视图函数 panic 时 Recovery 可以丢弃写了一半的响应，换成完整的错误响应
+func WithResponseBuffer() EngineOption {
+	return func(engine *Engine) {
+		engine.bufferResponse = true
+	}
+}
+
+// WithTrustedProxies 设置可信的代理，可以是 IP 或者 CIDR 例如：10.0.0.0/8、127.0.0.1
+// 只有请求直接来自可信代理时，ctx.ClientIP 才会读取 X-Forwarded-For 和 X-Real-IP，默认不信任任何代理
+func WithTrustedProxies(proxies ...string) EngineOption {
+	return func(engine *Engine) {
+		for _, proxy := range proxies {
+			cidr := proxy
+			if !strings.Contains(cidr, "/") {
+				if ip := net.ParseIP(cidr); ip != nil && ip.To4() != nil {
+					cidr += "/32"
+				} else {
+					cidr += "/128"
+				}
+			}
+			_, network, err := net.ParseCIDR(cidr)
+			if err != nil {
+				panic(fmt.Sprintf("web: 可信代理 %s 不是合法的 IP 或者 CIDR", proxy))
+			}
+			engine.trustedProxies = append(engine.trustedProxies, network)
+		}
+	}
+}
+
+// isTrustedProxy 判断 ip 是不是可信的代理
+func (e *Engine) isTrustedProxy(ip net.IP) bool {
+	for _, network := range e.trustedProxies {
+		if network.Contains(ip) {
+			return true
+		}
+	}
+	return false
 }
 
 type Engine struct {
 	router *router
 	*RouterGroup
-	groups []*RouterGroup // 保存所有的路由组信息，方便后期匹配路由组
+	groups []*RouterGroup // 通过 Group 创建的所有路由组，用来拼接兜底视图函数的执行链
 
-	// 模板引擎对象
+	noRoute  []HandlerFunc // 用户设置的 404 视图函数，不包含中间件
+	noMethod []HandlerFunc // 用户设置的 405 视图函数，不包含中间件
+
+	mode           Mode         // 运行模式
+	pool           sync.Pool    // Context 对象池，请求结束后回收复用
+	bufferResponse bool         // 是否缓冲所有响应
+	trustedProxies []*net.IPNet // 可信的代理，ClientIP 只信任它们转发的请求头
+
+	serverConfig  ServerConfig   // 底层 http.Server 的配置
+	mu            sync.Mutex     // 保护下面两个字段
+	servers       []*http.Server // 通过 Run 系列方法启动的服务，Shutdown 时统一关闭
+	shutdownHooks []func()       // 服务关闭时执行的钩子函数
+
+	// 模板引擎对象，注册了多个模板引擎时是 *TemplateRegistry，ctx.HTML 根据模板名字分发
 	T TemplateEngine
+
+	namedRoutes map[string]*namedRoute // 通过 Route.Name 命名的路由，Engine.URL 根据名字生成地址
+	// 结构体校验器，Bind 系列方法绑定成功后使用它校验，设置为 nil 表示不校验
+	Validator StructValidator
+	// ErrorHandler 视图函数执行完之后、中间件的后半段执行之前，如果 ctx.Errors 不为空就调用它生成统一的错误响应
+	// 默认是 DefaultErrorHandler，设置为 nil 表示不处理
+	ErrorHandler func(ctx *Context, errs ErrorList)
 }
 
 // 对外对接用户，对内对接Web框架
 func (e *Engine) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	// 构建Context上下文
-	ctx := NewContext(w, r)
-	// 请求来的时候，收集匹配当前URL地址的中间件函数
-	// 注意，这里只匹配中间件
-	for _, group := range e.groups {
-		if strings.HasPrefix(r.URL.Path, group.prefix) {
-			ctx.handlers = append(ctx.handlers, group.middlewares...)
-		}
-	}
+	// 从对象池中取出Context上下文并重置
+	ctx := e.pool.Get().(*Context)
+	ctx.reset(w, r)
 	// 将模板引擎对象交给上下文
 	ctx.T = e.T
+	ctx.engine = e
+	if e.bufferResponse {
+		ctx.Writer.Buffer()
+	}
 	// 转发请求到框架
-	// 里面匹配命中的视图函数
+	// 里面匹配命中的视图函数，中间件已经在注册路由时拼接好了
 	e.router.handle(ctx)
+	// 发送记录下来的状态码以及缓冲的响应体
+	ctx.writermem.finish()
+	// 请求处理完毕，放回对象池。视图函数不能在请求结束后继续持有 ctx
+	e.pool.Put(ctx)
+}
+
+// NoRoute 设置没有匹配到路由时执行的视图函数，默认返回 404
+// 请求地址所属路由组（前缀最长的那个）的中间件依然会在这些视图函数之前执行
+// 例如：/api/unknown 会经过全局中间件和 /api 路由组的中间件
+func (e *Engine) NoRoute(handlers ...HandlerFunc) {
+	if len(handlers) == 0 {
+		panic("web: NoRoute 至少需要一个视图函数")
+	}
+	e.noRoute = handlers
+	e.rebuildFallbacks()
+}
+
+// NoMethod 设置路由存在但请求方式不匹配时执行的视图函数，默认返回 405
+// 执行前已经设置好了 Allow 响应头，中间件的规则和 NoRoute 一样
+func (e *Engine) NoMethod(handlers ...HandlerFunc) {
+	if len(handlers) == 0 {
+		panic("web: NoMethod 至少需要一个视图函数")
+	}
+	e.noMethod = handlers
+	e.rebuildFallbacks()
+}
+
+// RegisterMatcher 注册路由参数的命名匹配器，需要在使用它的路由注册之前调用
+// 内置的匹配器有 int、uint、alpha、alphanum、uuid，同名时覆盖
+// 例如：engine.RegisterMatcher("slug", isSlug) 之后可以注册 /post/:name<slug>
+func (e *Engine) RegisterMatcher(name string, matcher ParamMatcher) {
+	if name == "" || strings.ContainsAny(name, "/<>{}") {
+		panic(fmt.Sprintf("web: 匹配器名字 %q 不合法", name))
+	}
+	if matcher == nil {
+		panic(fmt.Sprintf("web: 匹配器 %s 不能为 nil", name))
+	}
+	e.router.matchers[name] = matcher
 }
 
-// Run 手动启动服务，控制力强
-func (e *Engine) Run(addr string) error {
-	return http.ListenAndServe(addr, e)
+// rebuildFallbacks 重新拼接每个路由组的兜底执行链
+// 兜底的请求按照请求地址交给前缀最长的路由组，前缀相同时交给层级更深的路由组
+func (e *Engine) rebuildFallbacks() {
+	groups := append([]*RouterGroup{e.RouterGroup}, e.groups...)
+	sort.SliceStable(groups, func(i, j int) bool {
+		if len(groups[i].prefix) != len(groups[j].prefix) {
+			return len(groups[i].prefix) > len(groups[j].prefix)
+		}
+		return groups[i].depth() > groups[j].depth()
+	})
+	fallbacks := make([]*fallbackChain, 0, len(groups))
+	for _, group := range groups {
+		fallbacks = append(fallbacks, &fallbackChain{
+			prefix:   group.prefix,
+			noRoute:  group.combineHandlers(e.noRoute),
+			noMethod: group.combineHandlers(e.noMethod),
+			options:  group.combineHandlers([]HandlerFunc{autoOptionsHandler}),
+		})
+	}
+	e.router.fallbacks = fallbacks
 }
 
-func New() *Engine {
+func New(opts ...EngineOption) *Engine {
 	r := newRouter()
 	routerGroup := &RouterGroup{}
 	engine := &Engine{
-		router:      r,
-		RouterGroup: routerGroup,
-		groups:      []*RouterGroup{},
+		router:       r,
+		RouterGroup:  routerGroup,
+		noRoute:      []HandlerFunc{defaultNoRoute},
+		noMethod:     []HandlerFunc{defaultNoMethod},
+		Validator:    NewDefaultValidator(),
+		ErrorHandler: DefaultErrorHandler,
+		mode:         defaultMode(),
+		namedRoutes:  map[string]*namedRoute{},
 	}
 	routerGroup.engine = engine
+	engine.pool.New = func() any {
+		return &Context{params: make(Params, 0, 8)}
+	}
+	for _, opt := range opts {
+		opt(engine)
+	}
+	engine.rebuildFallbacks()
 	return engine
 }
 
@@ -69,52 +244,133 @@ type RouterGroup struct {
 	prefix      string        // 路由组前缀
 	parent      *RouterGroup  // 父级路由组
 	engine      *Engine       // 完全是为了路由组能够拿到路由树，而路由树又在Engine中
-	middlewares []HandlerFunc // 当前路由组中注册的所有中间件函数
+	middlewares []HandlerFunc // 当前路由组自己注册的中间件函数，不包含父级的
+	routed      bool          // 当前路由组或者子路由组是否已经注册过路由
 }
 
-func (group *RouterGroup) addRouter(method string, pattern string, handlerFunc HandlerFunc) {
+func (group *RouterGroup) addRouter(method string, pattern string, handlers ...HandlerFunc) *Route {
 	pattern = fmt.Sprintf("%s%s", group.prefix, pattern)
-	group.engine.router.addRouter(method, pattern, handlerFunc)
-	log.Printf("Add Router %4s - %s", method, pattern)
+	// 必须在拼接中间件之前检查，否则路由组的中间件会被当作视图函数
+	if len(handlers) == 0 {
+		panic(fmt.Sprintf("web: 路由 %s 至少需要一个视图函数", pattern))
+	}
+	// 在注册阶段就拼接好完整的执行链：父级中间件 > 当前路由组中间件 > 路由中间件 > 视图函数
+	chain := group.combineHandlers(handlers)
+	group.engine.router.addRouter(method, pattern, chain...)
+	for g := group; g != nil; g = g.parent {
+		g.routed = true
+	}
+	group.engine.debugPrint("%-7s %-25s --> %s (%d handlers)",
+		method, pattern, nameOfFunction(chain[len(chain)-1]), len(chain))
+	return &Route{Path: pattern, engine: group.engine}
 }
 
-func (group *RouterGroup) Group(prefix string) *RouterGroup {
+// combineHandlers 按照从根路由组到当前路由组的顺序收集中间件，最后拼上 handlers
+// 按照路由组的归属关系收集，而不是按照前缀字符串匹配，/v1 的中间件不会作用到 /v10 上
+func (group *RouterGroup) combineHandlers(handlers []HandlerFunc) []HandlerFunc {
+	groups := make([]*RouterGroup, 0)
+	for g := group; g != nil; g = g.parent {
+		groups = append(groups, g)
+	}
+	chain := make([]HandlerFunc, 0)
+	for i := len(groups) - 1; i >= 0; i-- {
+		chain = append(chain, groups[i].middlewares...)
+	}
+	return append(chain, handlers...)
+}
+
+// depth 路由组的层级，根路由组是 0
+func (group *RouterGroup) depth() int {
+	depth := 0
+	for g := group.parent; g != nil; g = g.parent {
+		depth++
+	}
+	return depth
+}
+
+// Group 创建子路由组，可以同时传入子路由组的中间件
+func (group *RouterGroup) Group(prefix string, middlewares ...HandlerFunc) *RouterGroup {
 	// 处理用户没有以 / 开头
 	if !strings.HasPrefix(prefix, "/") {
 		prefix = fmt.Sprintf("/%s", prefix)
 	}
 	newGroup := &RouterGroup{
-		prefix:      fmt.Sprintf("%s%s", group.prefix, prefix),
-		parent:      group,
-		engine:      group.engine,
-		middlewares: group.middlewares, // 必须填充父级的中间件方法列表
+		prefix: fmt.Sprintf("%s%s", group.prefix, prefix),
+		parent: group,
+		engine: group.engine,
 	}
-	// 向Engine的路由组列表字段添加新建的路由组
 	group.engine.groups = append(group.engine.groups, newGroup)
+	newGroup.Use(middlewares...)
 	return newGroup
 }
 
+// anyMethods Any 方法会注册的所有标准请求方式
+var anyMethods = []string{
+	http.MethodGet, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodHead, http.MethodOptions, http.MethodDelete, http.MethodConnect,
+	http.MethodTrace,
+}
+
+// Handle 使用任意请求方式注册路由，GET、POST等都是它的简化写法
+// 返回的 Route 可以继续设置名字 例如：engine.GET("/user/:id", getUser).Name("user")
+func (group *RouterGroup) Handle(method string, pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRouter(strings.ToUpper(method), pattern, handlers...)
+}
+
+// Any 使用所有标准请求方式注册同一个路由
+func (group *RouterGroup) Any(pattern string, handlers ...HandlerFunc) *Route {
+	var route *Route
+	for _, method := range anyMethods {
+		route = group.addRouter(method, pattern, handlers...)
+	}
+	return route
+}
+
 // GET 外部衍生API，提供给用户使用
-func (group *RouterGroup) GET(pattern string, handlerFunc HandlerFunc) {
-	group.addRouter(http.MethodGet, pattern, handlerFunc)
+func (group *RouterGroup) GET(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRouter(http.MethodGet, pattern, handlers...)
+}
+func (group *RouterGroup) POST(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRouter(http.MethodPost, pattern, handlers...)
 }
-func (group *RouterGroup) POST(pattern string, handlerFunc HandlerFunc) {
-	group.addRouter(http.MethodPost, pattern, handlerFunc)
+func (group *RouterGroup) DELETE(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRouter(http.MethodDelete, pattern, handlers...)
 }
-func (group *RouterGroup) DELETE(pattern string, handlerFunc HandlerFunc) {
-	group.addRouter(http.MethodDelete, pattern, handlerFunc)
+func (group *RouterGroup) PUT(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRouter(http.MethodPut, pattern, handlers...)
 }
-func (group *RouterGroup) PUT(pattern string, handlerFunc HandlerFunc) {
-	group.addRouter(http.MethodPut, pattern, handlerFunc)
+func (group *RouterGroup) PATCH(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRouter(http.MethodPatch, pattern, handlers...)
 }
 
+// HEAD 没有注册 HEAD 路由时，HEAD 请求会自动复用 GET 路由
+func (group *RouterGroup) HEAD(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRouter(http.MethodHead, pattern, handlers...)
+}
+func (group *RouterGroup) OPTIONS(pattern string, handlers ...HandlerFunc) *Route {
+	return group.addRouter(http.MethodOptions, pattern, handlers...)
+}
+
+// Use 注册中间件，必须在当前路由组注册路由之前调用
+// 执行链是在注册路由时拼接好的，之后再添加的中间件不会生效，所以这里直接报错
 func (group *RouterGroup) Use(middlewares ...HandlerFunc) {
+	if group.routed && len(middlewares) > 0 {
+		prefix := group.prefix
+		if prefix == "" {
+			prefix = "/"
+		}
+		panic(fmt.Sprintf("web: 路由组 %s 已经注册过路由，Use 必须在注册路由之前调用", prefix))
+	}
 	group.middlewares = append(group.middlewares, middlewares...)
+	// 路由组的中间件同样作用于属于它的兜底视图函数
+	if group.engine != nil {
+		group.engine.rebuildFallbacks()
+	}
 }
 
 // Default use Logger() & Recovery middlewares
-func Default() *Engine {
-	engine := New()
-	engine.Use(Recovery())
+func Default(opts ...EngineOption) *Engine {
+	engine := New(opts...)
+	engine.Use(Logger(LoggerConfig{}), Recovery())
 	return engine
 }
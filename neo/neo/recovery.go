@@ -1,20 +1,25 @@
 package neo
 
 import (
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"net"
 	"net/http"
+	"os"
 	"runtime"
 	"strings"
+	"syscall"
 )
 
 // print stack trace for debug
-func trace(message string) string {
+// skip 表示跳过的栈帧数量
+func stack(skip int) string {
 	var pcs [32]uintptr
-	n := runtime.Callers(3, pcs[:]) // skip first 3 caller
+	n := runtime.Callers(skip, pcs[:])
 
 	var str strings.Builder
-	str.WriteString(message + "\nTraceback:")
 	for _, pc := range pcs[:n] {
 		fn := runtime.FuncForPC(pc)
 		file, line := fn.FileLine(pc)
@@ -23,16 +28,85 @@ func trace(message string) string {
 	return str.String()
 }
 
+// RecoveryConfig 错误恢复中间件配置
+type RecoveryConfig struct {
+	// Output 日志写入的位置，默认是 os.Stderr，设置为 io.Discard 可以关闭日志
+	Output io.Writer
+	// OnPanic 捕获到 panic 之后执行，可以把 panic 的值和调用栈转发给错误追踪系统
+	// 客户端断开连接以及 http.ErrAbortHandler 导致的 panic 不会触发
+	OnPanic func(ctx *Context, err any, stack string)
+	// Handler 自定义错误响应，例如返回 JSON 格式的 problem details
+	// 默认返回纯文本的 500 Internal Server Error
+	Handler func(ctx *Context, err any)
+}
+
+// Recovery 使用默认配置的错误恢复中间件
 func Recovery() HandlerFunc {
+	return RecoveryWithConfig(RecoveryConfig{})
+}
+
+// RecoveryWithConfig 错误恢复中间件
+// 客户端已经断开连接时（broken pipe、connection reset）只记录日志，不再尝试写响应
+// http.ErrAbortHandler 记录日志之后重新 panic，由 net/http 直接断开连接
+func RecoveryWithConfig(config RecoveryConfig) HandlerFunc {
+	output := config.Output
+	if output == nil {
+		output = os.Stderr
+	}
+	logger := log.New(output, "", log.LstdFlags)
+	handler := config.Handler
+	if handler == nil {
+		handler = defaultRecoveryHandler
+	}
+
 	return func(c *Context) {
 		defer func() {
-			if err := recover(); err != nil {
-				message := fmt.Sprintf("%s", err)
-				log.Printf("%s\n\n", trace(message))
-				c.String(http.StatusInternalServerError, "Internal Server Error")
+			err := recover()
+			if err == nil {
+				return
+			}
+			if err == http.ErrAbortHandler {
+				// 视图函数主动中止响应（例如 ReverseProxy 转发到一半失败），交还给 net/http 断开连接，
+				// 不能当作正常响应发送出去，否则客户端会把半截数据当作完整的响应
+				logger.Printf("[Recovery] 视图函数中止了响应 %s %s\n", c.Method, c.URL)
+				c.Abort()
+				panic(err)
 			}
+			if isBrokenConnection(err) {
+				logger.Printf("[Recovery] 客户端已经断开连接 %s %s: %v\n", c.Method, c.URL, err)
+				c.Abort()
+				return
+			}
+			message := fmt.Sprintf("%v", err)
+			frames := stack(3)
+			logger.Printf("[Recovery] %s %s panic: %s\nTraceback:%s\n\n", c.Method, c.URL, message, frames)
+			if config.OnPanic != nil {
+				config.OnPanic(c, err, frames)
+			}
+			// 丢弃还没有发送的半截响应，响应头已经发出去时就没办法再改了
+			if c.Writer.Reset() {
+				handler(c, err)
+			}
+			c.Abort()
 		}()
 
 		c.Next()
 	}
 }
+
+func defaultRecoveryHandler(c *Context, _ any) {
+	c.String(http.StatusInternalServerError, "Internal Server Error")
+}
+
+// isBrokenConnection 判断 panic 是不是客户端断开连接引起的
+// 只看 panic 的值本身，请求超时或者被取消之后发生的其他 panic 依然是真正的错误，需要交给 OnPanic
+func isBrokenConnection(recovered any) bool {
+	if err, ok := recovered.(error); ok {
+		var opErr *net.OpError
+		if errors.As(err, &opErr) &&
+			(errors.Is(err, syscall.EPIPE) || errors.Is(err, syscall.ECONNRESET)) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,276 @@
+package neo
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Render 响应渲染器，ctx.Render 使用它生成响应体
+// 渲染器应该先完成序列化，成功之后再写响应头和响应体，失败时交给 Engine.ErrorHandler 生成错误响应
+type Render interface {
+	// Render 写入响应头和响应体
+	Render(w http.ResponseWriter) error
+	// WriteContentType 只写入 Content-Type，用于不允许有响应体的状态码
+	WriteContentType(w http.ResponseWriter)
+}
+
+const (
+	jsonContentType       = "application/json; charset=utf-8"
+	javascriptContentType = "application/javascript; charset=utf-8"
+	xmlContentType        = "application/xml; charset=utf-8"
+	yamlContentType       = "application/yaml; charset=utf-8"
+	htmlContentType       = "text/html; charset=utf-8"
+	plainContentType      = "text/plain; charset=utf-8"
+)
+
+// DefaultSecureJSONPrefix SecureJSON 默认的前缀
+const DefaultSecureJSONPrefix = "while(1);"
+
+func writeContentType(w http.ResponseWriter, contentType string) {
+	header := w.Header()
+	if header.Get("Content-Type") == "" {
+		header.Set("Content-Type", contentType)
+	}
+}
+
+// writeBody 写入 Content-Type 和响应体
+func writeBody(w http.ResponseWriter, contentType string, data []byte) error {
+	writeContentType(w, contentType)
+	_, err := w.Write(data)
+	return err
+}
+
+// JSONRender 普通的 JSON，<、>、& 会被转义成 \u003c 这种形式
+type JSONRender struct {
+	Data any
+}
+
+func (r JSONRender) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, jsonContentType, data)
+}
+
+func (r JSONRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// IndentedJSONRender 带缩进的 JSON，方便阅读
+type IndentedJSONRender struct {
+	Data any
+}
+
+func (r IndentedJSONRender) Render(w http.ResponseWriter) error {
+	data, err := json.MarshalIndent(r.Data, "", "    ")
+	if err != nil {
+		return err
+	}
+	return writeBody(w, jsonContentType, data)
+}
+
+func (r IndentedJSONRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// SecureJSONRender 数据是数组时在前面加上 Prefix，防止 JSON 劫持
+type SecureJSONRender struct {
+	Prefix string
+	Data   any
+}
+
+func (r SecureJSONRender) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	if bytes.HasPrefix(data, []byte("[")) {
+		data = append([]byte(r.Prefix), data...)
+	}
+	return writeBody(w, jsonContentType, data)
+}
+
+func (r SecureJSONRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// jsonpCallbackRegexp 合法的 JSONP 回调函数名，只允许标识符以及用 . 连接的属性访问 例如：app.callbacks.done
+var jsonpCallbackRegexp = regexp.MustCompile(`^[A-Za-z_$][\w$]*(\.[A-Za-z_$][\w$]*)*$`)
+
+// JSONPRender 把 JSON 包装成 Callback(...) 的调用
+// Callback 为空或者不是合法的函数名时和 JSONRender 一样，避免请求参数注入脚本
+type JSONPRender struct {
+	Callback string
+	Data     any
+}
+
+func (r JSONPRender) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	if !jsonpCallbackRegexp.MatchString(r.Callback) {
+		return writeBody(w, jsonContentType, data)
+	}
+	buf := bytes.NewBufferString(r.Callback)
+	buf.WriteByte('(')
+	buf.Write(data)
+	buf.WriteString(");")
+	return writeBody(w, javascriptContentType, buf.Bytes())
+}
+
+func (r JSONPRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, javascriptContentType)
+}
+
+// AsciiJSONRender 非 ASCII 字符都转义成 \uXXXX，响应体只包含 ASCII 字符
+type AsciiJSONRender struct {
+	Data any
+}
+
+func (r AsciiJSONRender) Render(w http.ResponseWriter) error {
+	data, err := json.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	buf := &bytes.Buffer{}
+	for _, c := range string(data) {
+		if c < 128 {
+			buf.WriteRune(c)
+			continue
+		}
+		if c > 0xFFFF {
+			// 超出基本平面的字符使用 UTF-16 代理对表示
+			c -= 0x10000
+			fmt.Fprintf(buf, `\u%04x\u%04x`, 0xD800+(c>>10), 0xDC00+(c&0x3FF))
+			continue
+		}
+		fmt.Fprintf(buf, `\u%04x`, c)
+	}
+	return writeBody(w, jsonContentType, buf.Bytes())
+}
+
+func (r AsciiJSONRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// PureJSONRender 不转义 HTML 字符的 JSON
+type PureJSONRender struct {
+	Data any
+}
+
+func (r PureJSONRender) Render(w http.ResponseWriter) error {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(r.Data); err != nil {
+		return err
+	}
+	return writeBody(w, jsonContentType, buf.Bytes())
+}
+
+func (r PureJSONRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, jsonContentType)
+}
+
+// XMLRender XML 格式
+type XMLRender struct {
+	Data any
+}
+
+func (r XMLRender) Render(w http.ResponseWriter) error {
+	data, err := xml.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, xmlContentType, data)
+}
+
+func (r XMLRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, xmlContentType)
+}
+
+// YAMLRender YAML 格式
+type YAMLRender struct {
+	Data any
+}
+
+func (r YAMLRender) Render(w http.ResponseWriter) error {
+	data, err := yaml.Marshal(r.Data)
+	if err != nil {
+		return err
+	}
+	return writeBody(w, yamlContentType, data)
+}
+
+func (r YAMLRender) WriteContentType(w http.ResponseWriter) {
+	writeContentType(w, yamlContentType)
+}
+
+// DataRender 原样返回 Data，ContentType 为空时使用 application/octet-stream
+type DataRender struct {
+	ContentType string
+	Data        []byte
+}
+
+func (r DataRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	_, err := w.Write(r.Data)
+	return err
+}
+
+func (r DataRender) WriteContentType(w http.ResponseWriter) {
+	contentType := r.ContentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	writeContentType(w, contentType)
+}
+
+// ReaderRender 把 Reader 中的数据复制到响应体中
+// ContentLength 小于 0 表示长度未知，Headers 是额外的响应头 例如：Content-Disposition
+type ReaderRender struct {
+	ContentType   string
+	ContentLength int64
+	Reader        io.Reader
+	Headers       map[string]string
+}
+
+func (r ReaderRender) Render(w http.ResponseWriter) error {
+	r.WriteContentType(w)
+	header := w.Header()
+	if r.ContentLength >= 0 {
+		header.Set("Content-Length", strconv.FormatInt(r.ContentLength, 10))
+	}
+	for key, value := range r.Headers {
+		if header.Get(key) == "" {
+			header.Set(key, value)
+		}
+	}
+	_, err := io.Copy(w, r.Reader)
+	return err
+}
+
+func (r ReaderRender) WriteContentType(w http.ResponseWriter) {
+	DataRender{ContentType: r.ContentType}.WriteContentType(w)
+}
+
+// bodyAllowedForStatus 1xx、204、304 响应不允许有响应体
+func bodyAllowedForStatus(code int) bool {
+	switch {
+	case code >= 100 && code <= 199:
+		return false
+	case code == http.StatusNoContent, code == http.StatusNotModified:
+		return false
+	}
+	return true
+}
@@ -0,0 +1,193 @@
+package neo
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"net/http"
+)
+
+// ResponseWriter 在 http.ResponseWriter 的基础上记录响应状态
+// 状态码不会立即发送，直到写入第一个字节或者请求结束，所以中间件在此之前都可以修改响应头
+type ResponseWriter interface {
+	http.ResponseWriter
+	http.Flusher
+	http.Hijacker
+
+	// Status 返回响应状态码，没有设置时是 200
+	Status() int
+	// Size 返回已经写入的响应体字节数
+	Size() int
+	// Written 返回视图函数是否已经写过状态码或者响应体
+	Written() bool
+	// Committed 返回响应头是否已经发送给客户端，发送之后就不能再修改了
+	Committed() bool
+	// WriteHeaderNow 立即发送响应头，用于只有状态码没有响应体的响应
+	WriteHeaderNow()
+	// Before 注册在发送响应头之前执行的钩子函数，后注册的先执行
+	Before(fn func(w ResponseWriter))
+	// Buffer 开启缓冲，之后写入的响应体先保存在内存中，请求结束时再统一发送
+	Buffer()
+	// Reset 丢弃还没有发送的状态码、响应体以及描述响应体的响应头，响应头已经发送时返回 false
+	// 中间件设置的其他响应头（例如跨域、Vary）会保留
+	Reset() bool
+	// Unwrap 返回原始的 http.ResponseWriter，供 http.ResponseController 使用
+	Unwrap() http.ResponseWriter
+}
+
+type responseWriter struct {
+	http.ResponseWriter
+	status    int
+	size      int
+	written   bool
+	committed bool
+	buffered  bool
+	noBody    bool // HEAD 请求复用 GET 路由时丢弃响应体
+	buf       bytes.Buffer
+	before    []func(w ResponseWriter)
+}
+
+var _ ResponseWriter = &responseWriter{}
+
+func (w *responseWriter) reset(writer http.ResponseWriter) {
+	w.ResponseWriter = writer
+	w.status = http.StatusOK
+	w.size = 0
+	w.written = false
+	w.committed = false
+	w.buffered = false
+	w.noBody = false
+	w.buf.Reset()
+	w.before = w.before[:0]
+}
+
+// WriteHeader 只记录状态码，响应头发送之后再调用会被忽略
+func (w *responseWriter) WriteHeader(code int) {
+	if code <= 0 || w.committed {
+		return
+	}
+	w.status = code
+	w.written = true
+}
+
+func (w *responseWriter) WriteHeaderNow() {
+	if w.committed {
+		return
+	}
+	w.committed = true
+	w.written = true
+	for i := len(w.before) - 1; i >= 0; i-- {
+		w.before[i](w)
+	}
+	w.ResponseWriter.WriteHeader(w.status)
+}
+
+func (w *responseWriter) Write(data []byte) (int, error) {
+	w.written = true
+	if w.noBody {
+		w.size += len(data)
+		return len(data), nil
+	}
+	if w.buffered {
+		n, err := w.buf.Write(data)
+		w.size += n
+		return n, err
+	}
+	w.WriteHeaderNow()
+	n, err := w.ResponseWriter.Write(data)
+	w.size += n
+	return n, err
+}
+
+func (w *responseWriter) WriteString(s string) (int, error) {
+	return w.Write([]byte(s))
+}
+
+func (w *responseWriter) Status() int {
+	return w.status
+}
+
+func (w *responseWriter) Size() int {
+	return w.size
+}
+
+func (w *responseWriter) Written() bool {
+	return w.written
+}
+
+func (w *responseWriter) Committed() bool {
+	return w.committed
+}
+
+func (w *responseWriter) Before(fn func(w ResponseWriter)) {
+	w.before = append(w.before, fn)
+}
+
+func (w *responseWriter) Buffer() {
+	if !w.committed {
+		w.buffered = true
+	}
+}
+
+// bodyHeaders 描述响应体的响应头，丢弃响应体时要一起删除，否则新的响应会带着旧的类型和长度
+var bodyHeaders = []string{
+	"Content-Type", "Content-Length", "Content-Encoding", "Content-Range",
+	"Content-Disposition", "ETag", "Last-Modified",
+}
+
+func (w *responseWriter) Reset() bool {
+	if w.committed {
+		return false
+	}
+	h := w.Header()
+	for _, key := range bodyHeaders {
+		h.Del(key)
+	}
+	w.buf.Reset()
+	w.status = http.StatusOK
+	w.size = 0
+	w.written = false
+	return true
+}
+
+// Flush 发送缓冲中的数据，之后不再缓冲，适用于流式响应
+func (w *responseWriter) Flush() {
+	w.flushBuffer()
+	w.buffered = false
+	if flusher, ok := w.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (w *responseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, errors.New("web: ResponseWriter 不支持 Hijack")
+	}
+	// 连接交给调用方之后，框架不能再写响应
+	w.committed = true
+	w.written = true
+	return hijacker.Hijack()
+}
+
+func (w *responseWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// flushBuffer 发送响应头以及缓冲中的响应体
+func (w *responseWriter) flushBuffer() {
+	w.WriteHeaderNow()
+	if w.buf.Len() > 0 {
+		_, _ = w.ResponseWriter.Write(w.buf.Bytes())
+		w.buf.Reset()
+	}
+}
+
+// finish 请求结束时调用，保证记录的状态码和缓冲的响应体都发送出去
+func (w *responseWriter) finish() {
+	if w.committed && w.buf.Len() == 0 {
+		return
+	}
+	w.flushBuffer()
+}
@@ -2,141 +2,226 @@ package neo
 
 import (
 	"fmt"
-	"log"
 	"net/http"
+	"sort"
+	"strconv"
 	"strings"
+	"unicode"
 )
 
 type router struct {
-	roots    map[string]*node       // 路由树，其实应该是路由森林，每一个HTTP method都有一颗树【key是method，value是节点】
-	handlers map[string]HandlerFunc // 路由和视图作绑定【key是路由，value是视图函数】
+	roots map[string]*node // 路由树，其实应该是路由森林，每一个HTTP method都有一颗树【key是method，value是节点】
+
+	// 每个路由组的兜底执行链，按照前缀从长到短排列，最后一个是根路由组
+	fallbacks   []*fallbackChain
+	autoOptions bool // 是否自动应答 OPTIONS 请求
+
+	matchers map[string]ParamMatcher // 路由参数约束中可以使用的命名匹配器
 }
 
-// 内部核心API，仅共内部使用，用于注册路由
-// 注册路由
-// method = GET | pattern = "/user/home" => parts = [user, home]
-// method = GET | pattern = "/user/order" => parts = [user, order]
-func (r *router) addRouter(method string, pattern string, handlerFunc HandlerFunc) {
-	root, ok := r.roots[method]
-	if !ok { // 根路由树不存在
-		root = &node{
-			part: "/",
-		}
-		r.roots[method] = root
+// ParamMatcher 路由参数的命名匹配器，判断一段路径能否作为参数值
+// 例如注册为 int 之后，路由中可以写 /user/:id<int> 或者 /user/{id:int}
+type ParamMatcher func(segment string) bool
+
+// defaultMatchers 内置的命名匹配器
+func defaultMatchers() map[string]ParamMatcher {
+	return map[string]ParamMatcher{
+		"int": func(segment string) bool {
+			_, err := strconv.ParseInt(segment, 10, 64)
+			return err == nil
+		},
+		"uint": func(segment string) bool {
+			_, err := strconv.ParseUint(segment, 10, 64)
+			return err == nil
+		},
+		"alpha":    runeMatcher(unicode.IsLetter),
+		"alphanum": runeMatcher(func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }),
+		"uuid":     uuidRegexp.MatchString,
 	}
-	// 特殊处理根路由
-	if pattern == "/" {
-		root.pattern = pattern
-		key := fmt.Sprintf("%s-%s", method, pattern)
-		r.handlers[key] = handlerFunc
-		log.Printf("Add Router %4s - %s", method, pattern)
-		return
+}
+
+// runeMatcher 每个字符都满足 fn 的匹配器
+func runeMatcher(fn func(r rune) bool) ParamMatcher {
+	return func(segment string) bool {
+		for _, r := range segment {
+			if !fn(r) {
+				return false
+			}
+		}
+		return segment != ""
 	}
+}
+
+// 内部核心API，仅共内部使用，用于注册路由
+// 注册路由
+// method = GET | pattern = "/user/home"
+// method = GET | pattern = "/user/:id"
+// method = GET | pattern = "/static/*filepath"
+func (r *router) addRouter(method string, pattern string, handlers ...HandlerFunc) {
 	// pattern 必须以 / 开头
 	if !strings.HasPrefix(pattern, "/") {
 		panic("web: 路由必须以 / 开头")
 	}
-	if strings.HasSuffix(pattern, "/") {
+	if pattern != "/" && strings.HasSuffix(pattern, "/") {
 		panic("web: 路由不能以 / 结尾")
 	}
-	// 切割pattern
-	parts := strings.Split(pattern[1:], "/")
-	for _, part := range parts {
-		if part == "" {
-			panic("web: 路由不能连续出现 / ")
-		}
-		child := root.search(part)
-		if child == nil { // 返回值是nil，说明当前节点下没有part的节点，需要新增
-			child = &node{ // 这里不需要添加pattern字段，只有最底层的叶子节点才需要添加。我们统一在循环之后再添加
-				part: part,
-			}
-			// 如果part中带有 : 表示是模糊匹配，需要给节点的isWild设为true
-			if strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*") {
-				child.isWild = true
-			}
-			root.children = append(root.children, child)
-		}
-		if (strings.Contains(child.part, ":") && strings.Contains(part, "*")) || strings.Contains(child.part, "*") && strings.Contains(part, ":") {
-			panic("web: 模糊匹配冲突")
-		}
-		root = child // 查找到了child，沿着child继续查找
+	if strings.Contains(pattern, "//") {
+		panic("web: 路由不能连续出现 / ")
 	}
-	root.pattern = pattern
-	key := fmt.Sprintf("%s-%s", method, pattern)
-	r.handlers[key] = handlerFunc
-
+	if len(handlers) == 0 {
+		panic(fmt.Sprintf("web: 路由 %s 至少需要一个视图函数", pattern))
+	}
+	root, ok := r.roots[method]
+	if !ok { // 根路由树不存在
+		root = &node{}
+		r.roots[method] = root
+	}
+	// 路由冲突在注册阶段就直接暴露出来
+	n, err := root.addRoute(pattern, r.matchers)
+	if err != nil {
+		panic(err.Error())
+	}
+	// 执行链直接挂在终点节点上，匹配到节点就拿到了执行链，不需要再拼接 key 查表
+	n.handlers = handlers
 }
 
 // 匹配路由
-func (r *router) getRouter(method string, pattern string) (*node, map[string]string) {
-	params := make(map[string]string)
+// 按照 静态 > 参数 > 通配 的优先级匹配，某条分支走不通时会回溯
+// 匹配到的参数追加到 params 中，调用方可以传入复用的切片，避免每次请求都分配内存
+func (r *router) getRouter(method string, path string, params *Params) *node {
 	root, ok := r.roots[method]
 	if !ok {
 		// 路由树都不存在，直接返回nil
-		return nil, params
-	}
-	// 特殊处理 根路由
-	if pattern == "/" {
-		return root, params
-	}
-	// 切割pattern
-	pattern = strings.Trim(pattern, "/")
-	parts := strings.Split(pattern, "/")
-	for _, part := range parts {
-		if part == "" {
-			return nil, params
-		}
-		child := root.search(part)
-		if child == nil {
-			return nil, params
-		}
-		// 将匹配到的带有:的路由添加到params中
-		if child.isWild {
-			// 完成*的模糊匹配
-			// 这也是由优先级的
-			// : 优先级高于 *
-			if strings.HasPrefix(child.part, ":") {
-				params[child.part[1:]] = part
-			} else if strings.HasPrefix(child.part, "*") {
-				params[child.part[1:]] = pattern[strings.Index(pattern, part):]
-			}
-		}
-		// 1. child.pattern != ""这是精确匹配，但是还不够，有点缺陷
-		// 2. child.pattern == fmt.Sprintf("/%s", pattern) 这是精确匹配，搭配条件1才是完美
-		// 上述两个条件只有配合使用才能精确匹配路由。/login 和 /login/123 两种路由都能匹配到
-		// 3. child.isWild 这是模糊匹配，优先级低于精确匹配
-		if (child.pattern != "" && child.pattern == fmt.Sprintf("/%s", pattern)) || child.isWild {
-			return child, params
+		return nil
+	}
+	size := len(*params)
+	if n := root.search(path, params); n != nil {
+		return n
+	}
+	// 兼容末尾带 / 的请求地址，例如 /login/ 也能命中 /login
+	if len(path) > 1 && strings.HasSuffix(path, "/") {
+		*params = (*params)[:size]
+		if n := root.search(strings.TrimRight(path, "/"), params); n != nil {
+			return n
 		}
-		root = child
 	}
-	return nil, params
+	*params = (*params)[:size]
+	return nil
 }
 
 func (r *router) handle(ctx *Context) {
-	// 请求来了，需要匹配路由
-	log.Printf("Request %4s - %s", ctx.Method, ctx.URL)
-	n, params := r.getRouter(ctx.Method, ctx.URL)
+	// 请求来了，需要匹配路由，访问日志交给 Logger 中间件记录
+	// 请求参数直接保存到Context上下文中复用的切片里
+	n := r.getRouter(ctx.Method, ctx.URL, &ctx.params)
+	if n == nil && ctx.Method == http.MethodHead {
+		// HEAD 请求没有单独注册时，复用 GET 的视图函数，但不返回响应体
+		if n = r.getRouter(http.MethodGet, ctx.URL, &ctx.params); n != nil {
+			ctx.writermem.noBody = true
+		}
+	}
 	if n == nil {
 		// 没有匹配到
-		ctx.String(http.StatusInternalServerError, "NOT FOUND")
+		r.fallback(ctx)
 		return
 	}
-	// 保存请求参数到Context上下文中
-	ctx.params = params
-	key := fmt.Sprintf("%s-%s", ctx.Method, n.pattern)
-	handlerFunc, ok := r.handlers[key]
-	if !ok {
-		ctx.String(http.StatusInternalServerError, "NOT FOUND")
-		return
-	}
-	// 将命中的视图函数添加到当前上下文的视图函数列表中的最后一位
-	ctx.handlers = append(ctx.handlers, handlerFunc)
+	ctx.fullPath = n.pattern
+	// 执行链在注册时已经拼接好了，直接交给上下文，不需要再拷贝
+	ctx.handlers = n.handlers
 	// 执行命中的视图函数，统一在上下文的Next方法中执行
 	ctx.Next()
-	//handlerFunc(ctx)
+}
+
+// fallbackChain 一个路由组的兜底执行链，已经拼接好从根路由组到这个路由组的中间件
+type fallbackChain struct {
+	prefix   string
+	noRoute  []HandlerFunc // 没有匹配到路由时执行，对应 404
+	noMethod []HandlerFunc // 路由存在但请求方式不对时执行，对应 405
+	options  []HandlerFunc // 自动应答 OPTIONS 请求
+}
+
+// owns 判断 path 是否属于这个路由组，按照路径段匹配，/api 不包含 /api2
+func (f *fallbackChain) owns(path string) bool {
+	if !strings.HasPrefix(path, f.prefix) {
+		return false
+	}
+	return len(path) == len(f.prefix) || strings.HasSuffix(f.prefix, "/") || path[len(f.prefix)] == '/'
+}
+
+// fallbackFor 返回前缀最长的、包含 path 的路由组的兜底执行链，都不包含时是根路由组的
+func (r *router) fallbackFor(path string) *fallbackChain {
+	for _, f := range r.fallbacks {
+		if f.owns(path) {
+			return f
+		}
+	}
+	return r.fallbacks[len(r.fallbacks)-1]
+}
+
+// fallback 处理没有命中的请求，区分是路由不存在(404)还是请求方式不对(405)
+func (r *router) fallback(ctx *Context) {
+	chain := r.fallbackFor(ctx.URL)
+	if allow := r.allowed(ctx.URL, ctx.Method); len(allow) > 0 {
+		ctx.SetHeader("Allow", strings.Join(allow, ", "))
+		if r.autoOptions && ctx.Method == http.MethodOptions {
+			ctx.handlers = chain.options
+		} else {
+			ctx.handlers = chain.noMethod
+		}
+	} else {
+		ctx.handlers = chain.noRoute
+	}
+	// 兜底的视图函数同样要经过请求地址所属路由组的中间件
+	ctx.Next()
+}
+
+// allowed 返回在其他请求方式下能匹配 path 的所有请求方式，用于填充 Allow 响应头
+func (r *router) allowed(path string, method string) []string {
+	allow := make([]string, 0)
+	for m := range r.roots {
+		if m == method {
+			continue
+		}
+		var params Params
+		if n := r.getRouter(m, path, &params); n != nil {
+			allow = append(allow, m)
+		}
+	}
+	// HEAD 会自动复用 GET 的路由
+	if containsMethod(allow, http.MethodGet) && !containsMethod(allow, http.MethodHead) && method != http.MethodHead {
+		allow = append(allow, http.MethodHead)
+	}
+	if r.autoOptions && len(allow) > 0 && !containsMethod(allow, http.MethodOptions) {
+		allow = append(allow, http.MethodOptions)
+	}
+	sort.Strings(allow)
+	return allow
+}
+
+func containsMethod(methods []string, method string) bool {
+	for _, m := range methods {
+		if m == method {
+			return true
+		}
+	}
+	return false
+}
+
+// autoOptionsHandler 自动应答 OPTIONS 请求，Allow 响应头在此之前已经设置好了
+func autoOptionsHandler(ctx *Context) {
+	ctx.Status(http.StatusNoContent)
+}
+
+func defaultNoRoute(ctx *Context) {
+	ctx.String(http.StatusNotFound, "404 NOT FOUND")
+}
+
+func defaultNoMethod(ctx *Context) {
+	ctx.String(http.StatusMethodNotAllowed, "405 METHOD NOT ALLOWED")
 }
 
 func newRouter() *router {
-	return &router{roots: map[string]*node{}, handlers: map[string]HandlerFunc{}}
+	return &router{
+		roots:    map[string]*node{},
+		matchers: defaultMatchers(),
+	}
 }
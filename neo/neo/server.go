@@ -0,0 +1,143 @@
+package neo
+
+import (
+	"context"
+	"errors"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+// ServerConfig 底层 http.Server 的配置，零值表示不限制
+type ServerConfig struct {
+	ReadTimeout       time.Duration // 读取整个请求（包括请求体）的超时时间
+	ReadHeaderTimeout time.Duration // 读取请求头的超时时间
+	WriteTimeout      time.Duration // 写响应的超时时间
+	IdleTimeout       time.Duration // keep-alive 连接的空闲超时时间
+	MaxHeaderBytes    int           // 请求头的最大字节数，0 表示使用 http.DefaultMaxHeaderBytes
+}
+
+// WithServer 设置底层 http.Server 的超时时间等配置，对所有 Run 系列方法生效
+func WithServer(config ServerConfig) EngineOption {
+	return func(engine *Engine) {
+		engine.serverConfig = config
+	}
+}
+
+// OnShutdown 注册服务关闭时执行的钩子函数，例如关闭数据库连接
+// 钩子函数在所有正在处理的请求结束之后，按照注册顺序依次执行
+func (e *Engine) OnShutdown(hooks ...func()) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.shutdownHooks = append(e.shutdownHooks, hooks...)
+}
+
+// Run 手动启动服务，控制力强
+func (e *Engine) Run(addr string) error {
+	e.debugPrint("Listening and serving HTTP on %s", addr)
+	return e.newServer(addr).ListenAndServe()
+}
+
+// RunTLS 启动 HTTPS 服务
+func (e *Engine) RunTLS(addr string, certFile string, keyFile string) error {
+	e.debugPrint("Listening and serving HTTPS on %s", addr)
+	return e.newServer(addr).ListenAndServeTLS(certFile, keyFile)
+}
+
+// RunUnix 在 Unix Domain Socket 上启动服务，已经存在的 socket 文件会被删除
+func (e *Engine) RunUnix(file string) error {
+	if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	listener, err := net.Listen("unix", file)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = os.Remove(file) }()
+	e.debugPrint("Listening and serving HTTP on unix:%s", file)
+	return e.newServer("").Serve(listener)
+}
+
+// RunListener 在调用方提供的 net.Listener 上启动服务
+func (e *Engine) RunListener(listener net.Listener) error {
+	e.debugPrint("Listening and serving HTTP on listener %s", listener.Addr())
+	return e.newServer(listener.Addr().String()).Serve(listener)
+}
+
+// RunWithGracefulShutdown 启动服务并监听退出信号，默认是 SIGINT 和 SIGTERM
+// 收到信号后不再接收新的连接，最多等待 timeout 让正在处理的请求结束，然后执行关闭钩子
+func (e *Engine) RunWithGracefulShutdown(addr string, timeout time.Duration, signals ...os.Signal) error {
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, signals...)
+	defer signal.Stop(quit)
+
+	// 先同步创建好 http.Server，保证收到信号时 Shutdown 一定能关闭它
+	server := e.newServer(addr)
+	e.debugPrint("Listening and serving HTTP on %s", addr)
+	errCh := make(chan error, 1)
+	go func() {
+		errCh <- server.ListenAndServe()
+	}()
+
+	select {
+	case err := <-errCh:
+		// 服务没能正常启动，例如端口被占用
+		return err
+	case <-quit:
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+	if err := e.Shutdown(ctx); err != nil {
+		return err
+	}
+	if err := <-errCh; !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+// Shutdown 优雅关闭所有通过 Run 系列方法启动的服务
+// 先停止接收新的连接，等待正在处理的请求结束或者 ctx 超时，然后执行关闭钩子，每个钩子只会执行一次
+func (e *Engine) Shutdown(ctx context.Context) error {
+	e.mu.Lock()
+	servers := e.servers
+	hooks := e.shutdownHooks
+	e.servers = nil
+	// 钩子只执行一次，RunWithGracefulShutdown 和手动调用的 Shutdown 同时发生时不会重复执行
+	e.shutdownHooks = nil
+	e.mu.Unlock()
+
+	var err error
+	for _, server := range servers {
+		if shutdownErr := server.Shutdown(ctx); shutdownErr != nil && err == nil {
+			err = shutdownErr
+		}
+	}
+	for _, hook := range hooks {
+		hook()
+	}
+	return err
+}
+
+// newServer 按照配置创建 http.Server，并记录下来供 Shutdown 使用
+func (e *Engine) newServer(addr string) *http.Server {
+	server := &http.Server{
+		Addr:              addr,
+		Handler:           e,
+		ReadTimeout:       e.serverConfig.ReadTimeout,
+		ReadHeaderTimeout: e.serverConfig.ReadHeaderTimeout,
+		WriteTimeout:      e.serverConfig.WriteTimeout,
+		IdleTimeout:       e.serverConfig.IdleTimeout,
+		MaxHeaderBytes:    e.serverConfig.MaxHeaderBytes,
+	}
+	e.mu.Lock()
+	e.servers = append(e.servers, server)
+	e.mu.Unlock()
+	return server
+}
@@ -3,7 +3,17 @@ package neo
 import (
 	"bytes"
 	"context"
+	"errors"
+	"fmt"
 	"html/template"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	texttemplate "text/template"
 )
 
 // TemplateEngine 模板引擎抽象
@@ -17,28 +27,417 @@ type TemplateEngine interface {
 	Render(ctx context.Context, tplName string, data any) ([]byte, error)
 }
 
+// engineAware 通过 WithTemplateOnEngine 设置时需要拿到 Engine 的模板引擎
+// 例如开发模式下热加载、模板中使用 url 函数生成命名路由的地址
+type engineAware interface {
+	bindEngine(engine *Engine)
+}
+
 type GoTemplateEngine struct {
+	// T 没有使用布局时，所有模板都在这里；使用布局时只包含布局和公共模板
 	T *template.Template
+
+	mu        sync.RWMutex
+	pages     map[string]*template.Template // 使用布局时，每个页面和布局单独组成一组模板
+	source    *templateSource               // 模板文件的来源，直接传入 *template.Template 时为空
+	config    goTemplateConfig
+	signature string  // 上次加载时所有文件的名字、修改时间和大小，用来判断文件是否变化
+	engine    *Engine // 模板函数 url 使用它生成地址
 }
 
 func NewGoTemplateEngine(t *template.Template) TemplateEngine {
 	return &GoTemplateEngine{T: t}
 }
 
+// goTemplateConfig 从文件加载模板时的配置
+type goTemplateConfig struct {
+	funcMap        template.FuncMap
+	leftDelim      string
+	rightDelim     string
+	layout         string   // 布局模板的名字
+	partials       []string // 公共模板的匹配规则
+	extensions     []string // 从目录加载时只加载这些后缀的文件
+	hotReload      bool
+	hotReloadIsSet bool // 用户明确设置过热加载时，不再跟随运行模式
+}
+
+// GoTemplateOption 从文件加载模板时的可选配置
+type GoTemplateOption func(config *goTemplateConfig)
+
+// WithFuncMap 注册模板中可以使用的函数
+func WithFuncMap(funcMap template.FuncMap) GoTemplateOption {
+	return func(config *goTemplateConfig) {
+		if config.funcMap == nil {
+			config.funcMap = template.FuncMap{}
+		}
+		for name, fn := range funcMap {
+			config.funcMap[name] = fn
+		}
+	}
+}
+
+// WithDelims 设置模板的分隔符，默认是 {{ 和 }}
+func WithDelims(left string, right string) GoTemplateOption {
+	return func(config *goTemplateConfig) {
+		config.leftDelim = left
+		config.rightDelim = right
+	}
+}
+
+// WithLayout 设置布局模板，渲染页面时实际执行的是布局，页面通过 define 填充布局中的 block
+// 例如布局中写 {{block "content" .}}{{end}}，页面中写 {{define "content"}}...{{end}}
+// 每个页面会单独和布局组成一组模板，不同页面定义的同名 block 互不影响
+func WithLayout(name string) GoTemplateOption {
+	return func(config *goTemplateConfig) {
+		config.layout = name
+	}
+}
+
+// WithPartials 设置公共模板的匹配规则 例如：partials/*.html，公共模板在所有页面中都可以 template 引用
+func WithPartials(patterns ...string) GoTemplateOption {
+	return func(config *goTemplateConfig) {
+		config.partials = append(config.partials, patterns...)
+	}
+}
+
+// WithExtensions 从目录或者 fs.FS 加载时只加载这些后缀的文件，默认是 .html
+func WithExtensions(extensions ...string) GoTemplateOption {
+	return func(config *goTemplateConfig) {
+		config.extensions = extensions
+	}
+}
+
+// WithHotReload 是否在模板文件变化后重新加载
+// 默认跟随 Engine 的运行模式，开发模式下开启，需要通过 WithTemplateOnEngine 设置模板引擎
+func WithHotReload(enabled bool) GoTemplateOption {
+	return func(config *goTemplateConfig) {
+		config.hotReload = enabled
+		config.hotReloadIsSet = true
+	}
+}
+
+// NewGoTemplateEngineFromGlob 加载匹配 pattern 的所有文件，模板名字是文件名 例如：index.html
+func NewGoTemplateEngineFromGlob(pattern string, opts ...GoTemplateOption) (*GoTemplateEngine, error) {
+	source := &templateSource{
+		fsys: osFS{},
+		list: func() ([]templateFile, error) {
+			matches, err := filepath.Glob(pattern)
+			if err != nil {
+				return nil, err
+			}
+			files := make([]templateFile, 0, len(matches))
+			for _, match := range matches {
+				files = append(files, templateFile{name: filepath.Base(match), path: match})
+			}
+			return files, nil
+		},
+	}
+	return newGoTemplateEngine(source, opts...)
+}
+
+// NewGoTemplateEngineFromDir 递归加载目录 dir 中的模板，模板名字是相对 dir 的路径 例如：user/list.html
+func NewGoTemplateEngineFromDir(dir string, opts ...GoTemplateOption) (*GoTemplateEngine, error) {
+	return NewGoTemplateEngineFromFS(os.DirFS(dir), opts...)
+}
+
+// NewGoTemplateEngineFromFS 递归加载 fsys 中的模板，模板名字是文件在 fsys 中的路径
+// embed.FS 中的模板在子目录时可以先用 fs.Sub 取出子目录
+func NewGoTemplateEngineFromFS(fsys fs.FS, opts ...GoTemplateOption) (*GoTemplateEngine, error) {
+	source := &templateSource{fsys: fsys}
+	source.list = func() ([]templateFile, error) {
+		files := make([]templateFile, 0)
+		err := fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() && source.accept(name) {
+				files = append(files, templateFile{name: name, path: name})
+			}
+			return nil
+		})
+		return files, err
+	}
+	return newGoTemplateEngine(source, opts...)
+}
+
+func newGoTemplateEngine(source *templateSource, opts ...GoTemplateOption) (*GoTemplateEngine, error) {
+	config := goTemplateConfig{extensions: []string{".html"}}
+	for _, opt := range opts {
+		opt(&config)
+	}
+	source.extensions = config.extensions
+	g := &GoTemplateEngine{source: source, config: config}
+	if err := g.load(); err != nil {
+		return nil, err
+	}
+	return g, nil
+}
+
 // Render 渲染数据
 func (g *GoTemplateEngine) Render(ctx context.Context, tplName string, data any) ([]byte, error) {
+	if g.config.hotReload && g.source != nil {
+		if err := g.reloadIfChanged(); err != nil {
+			return nil, err
+		}
+	}
+	g.mu.RLock()
+	t, name := g.T, tplName
+	if page, ok := g.pages[tplName]; ok {
+		// 页面通过布局渲染
+		t, name = page, g.config.layout
+	}
+	g.mu.RUnlock()
 	// 这里的任务就是将 data 渲染到 模板名是 tplName 的模板中。
-	// 那就是用 html/template 包
-	// 从哪来？或者说，怎么渲染
 	buf := &bytes.Buffer{}
 	// ExecuteTemplate：将data渲染到tplName中，并将最后出来的结果放在buf中
-	err := g.T.ExecuteTemplate(buf, tplName, data)
+	err := t.ExecuteTemplate(buf, name, data)
+	return buf.Bytes(), err
+}
+
+// bindEngine 跟随 Engine 的运行模式决定是否热加载，并让模板函数 url 可用
+func (g *GoTemplateEngine) bindEngine(engine *Engine) {
+	if !g.config.hotReloadIsSet {
+		g.config.hotReload = engine.IsDebugging()
+	}
+	g.engine = engine
+	// 直接传入的 *template.Template 没有内置 url 函数，这里补上
+	// 解析模板时就用到 url 的话，需要自己在 Funcs 中先放一个同名函数
+	if g.source == nil && g.T != nil {
+		g.T.Funcs(template.FuncMap{"url": g.url})
+	}
+}
+
+// url 模板函数，根据路由名字生成地址 例如：{{url "user" "id" .ID}}
+func (g *GoTemplateEngine) url(name string, params ...any) (string, error) {
+	if g.engine == nil {
+		return "", errors.New("web: 模板引擎需要通过 WithTemplateOnEngine 设置之后才能使用 url 函数")
+	}
+	return g.engine.URL(name, params...)
+}
+
+// reloadIfChanged 模板文件新增、删除或者修改之后重新加载
+func (g *GoTemplateEngine) reloadIfChanged() error {
+	_, signature, err := g.source.scan()
+	if err != nil {
+		return err
+	}
+	g.mu.RLock()
+	changed := signature != g.signature
+	g.mu.RUnlock()
+	if !changed {
+		return nil
+	}
+	return g.load()
+}
+
+// load 读取并解析所有模板文件
+func (g *GoTemplateEngine) load() error {
+	files, signature, err := g.source.scan()
+	if err != nil {
+		return err
+	}
+	if len(files) == 0 {
+		return errors.New("web: 没有找到模板文件")
+	}
+	shared := g.newTemplate()
+	pages := make(map[string]string)
+	for _, file := range files {
+		content, err := fs.ReadFile(g.source.fsys, file.path)
+		if err != nil {
+			return err
+		}
+		// 没有布局时所有模板解析到同一组中
+		if g.config.layout == "" || file.name == g.config.layout || g.isPartial(file.name) {
+			if _, err = shared.New(file.name).Parse(string(content)); err != nil {
+				return err
+			}
+			continue
+		}
+		pages[file.name] = string(content)
+	}
+	var pageTemplates map[string]*template.Template
+	if g.config.layout != "" {
+		if shared.Lookup(g.config.layout) == nil {
+			return fmt.Errorf("web: 没有找到布局模板 %s", g.config.layout)
+		}
+		pageTemplates = make(map[string]*template.Template, len(pages))
+		for name, content := range pages {
+			t, err := shared.Clone()
+			if err != nil {
+				return err
+			}
+			if _, err = t.New(name).Parse(content); err != nil {
+				return err
+			}
+			pageTemplates[name] = t
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.T = shared
+	g.pages = pageTemplates
+	g.signature = signature
+	return nil
+}
+
+// newTemplate 创建空模板，内置 url 函数，用户注册的同名函数会覆盖它
+func (g *GoTemplateEngine) newTemplate() *template.Template {
+	t := template.New("").Delims(g.config.leftDelim, g.config.rightDelim)
+	t = t.Funcs(template.FuncMap{"url": g.url})
+	if g.config.funcMap != nil {
+		t = t.Funcs(g.config.funcMap)
+	}
+	return t
+}
+
+func (g *GoTemplateEngine) isPartial(name string) bool {
+	for _, pattern := range g.config.partials {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// templateFile 模板文件，name 是模板名字，path 是文件在 fsys 中的路径
+type templateFile struct {
+	name string
+	path string
+}
+
+// templateSource 模板文件的来源
+type templateSource struct {
+	fsys       fs.FS
+	list       func() ([]templateFile, error)
+	extensions []string
+}
+
+func (s *templateSource) accept(name string) bool {
+	for _, ext := range s.extensions {
+		if strings.HasSuffix(name, ext) {
+			return true
+		}
+	}
+	return false
+}
+
+// scan 列出所有模板文件，并根据文件的名字、修改时间和大小生成签名
+func (s *templateSource) scan() ([]templateFile, string, error) {
+	files, err := s.list()
+	if err != nil {
+		return nil, "", err
+	}
+	var b strings.Builder
+	for _, file := range files {
+		info, err := fs.Stat(s.fsys, file.path)
+		if err != nil {
+			return nil, "", err
+		}
+		fmt.Fprintf(&b, "%s|%d|%d;", file.name, info.ModTime().UnixNano(), info.Size())
+	}
+	return files, b.String(), nil
+}
+
+// osFS 直接读取本地文件，用于 glob 匹配出来的路径，路径可以是绝对路径
+type osFS struct{}
+
+func (osFS) Open(name string) (fs.File, error) {
+	return os.Open(name)
+}
+
+// TextTemplateEngine 基于 text/template 的模板引擎，不会转义 HTML，适合邮件、纯文本等场景
+type TextTemplateEngine struct {
+	T *texttemplate.Template
+}
+
+func NewTextTemplateEngine(t *texttemplate.Template) TemplateEngine {
+	return &TextTemplateEngine{T: t}
+}
+
+// Render 渲染数据
+func (e *TextTemplateEngine) Render(ctx context.Context, tplName string, data any) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	err := e.T.ExecuteTemplate(buf, tplName, data)
 	return buf.Bytes(), err
 }
 
-// ParseGlob 解析模板
-//func (g *GoTemplateEngine) ParseGlob(tplName string) error {
-//	var err error
-//	g.T, err = g.T.ParseGlob(tplName)
-//	return err
-//}
+// TemplateRegistry 根据模板名字把渲染分发给不同的模板引擎，它本身也是一个 TemplateEngine
+// 匹配顺序：最长的名字前缀、文件后缀、默认模板引擎
+type TemplateRegistry struct {
+	prefixes   []templatePrefix // 按照前缀长度从长到短排列
+	extensions map[string]TemplateEngine
+	fallback   TemplateEngine
+}
+
+type templatePrefix struct {
+	prefix string
+	engine TemplateEngine
+}
+
+func NewTemplateRegistry() *TemplateRegistry {
+	return &TemplateRegistry{extensions: make(map[string]TemplateEngine)}
+}
+
+// RegisterExtension 后缀是 ext 的模板交给 t 渲染 例如：RegisterExtension(".tmpl", textEngine)
+func (r *TemplateRegistry) RegisterExtension(ext string, t TemplateEngine) {
+	if !strings.HasPrefix(ext, ".") {
+		panic(fmt.Sprintf("web: 模板后缀 %s 必须以 . 开头", ext))
+	}
+	r.extensions[ext] = t
+}
+
+// RegisterPrefix 名字以 prefix 开头的模板交给 t 渲染 例如：RegisterPrefix("emails/", textEngine)
+func (r *TemplateRegistry) RegisterPrefix(prefix string, t TemplateEngine) {
+	for i, p := range r.prefixes {
+		if p.prefix == prefix {
+			r.prefixes[i].engine = t
+			return
+		}
+	}
+	r.prefixes = append(r.prefixes, templatePrefix{prefix: prefix, engine: t})
+	sort.SliceStable(r.prefixes, func(i, j int) bool {
+		return len(r.prefixes[i].prefix) > len(r.prefixes[j].prefix)
+	})
+}
+
+// SetDefault 没有匹配到前缀和后缀时使用的模板引擎
+func (r *TemplateRegistry) SetDefault(t TemplateEngine) {
+	r.fallback = t
+}
+
+// Render 找到模板名字对应的模板引擎并渲染
+func (r *TemplateRegistry) Render(ctx context.Context, tplName string, data any) ([]byte, error) {
+	t := r.lookup(tplName)
+	if t == nil {
+		return nil, fmt.Errorf("web: 没有找到模板 %s 对应的模板引擎", tplName)
+	}
+	return t.Render(ctx, tplName, data)
+}
+
+func (r *TemplateRegistry) lookup(tplName string) TemplateEngine {
+	for _, p := range r.prefixes {
+		if strings.HasPrefix(tplName, p.prefix) {
+			return p.engine
+		}
+	}
+	if t, ok := r.extensions[path.Ext(tplName)]; ok {
+		return t
+	}
+	return r.fallback
+}
+
+func (r *TemplateRegistry) bindEngine(engine *Engine) {
+	engines := []TemplateEngine{r.fallback}
+	for _, p := range r.prefixes {
+		engines = append(engines, p.engine)
+	}
+	for _, t := range r.extensions {
+		engines = append(engines, t)
+	}
+	for _, t := range engines {
+		if e, ok := t.(engineAware); ok {
+			e.bindEngine(engine)
+		}
+	}
+}
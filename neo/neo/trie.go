@@ -1,27 +1,355 @@
 package neo
 
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// nodeType 节点类型，同时也决定了匹配的优先级：静态 > 参数 > 通配
+type nodeType uint8
+
+const (
+	nodeStatic   nodeType = iota // 静态节点 例如：/user/profile
+	nodeParam                    // 参数节点 例如：/user/:id、/user/{id:[0-9]+}
+	nodeCatchAll                 // 通配节点 例如：/static/*filepath
+)
+
+// Param 单个路由参数
+type Param struct {
+	Key   string
+	Value string
+}
+
+// Params 路由参数列表，按照在路由中出现的顺序保存
+type Params []Param
+
+// Get 根据参数名获取参数值
+func (ps Params) Get(key string) (string, bool) {
+	for _, p := range ps {
+		if p.Key == key {
+			return p.Value, true
+		}
+	}
+	return "", false
+}
+
+// node 压缩前缀树（Radix Tree）的节点
+// 静态子节点按首字节索引，参数子节点和通配子节点单独保存，
+// 这样匹配时可以严格按照 静态 > 参数 > 通配 的优先级依次尝试，失败后回溯
 type node struct {
-	pattern  string  // 叶子节点唯一标识 例如：/study/:lang
-	part     string  // 单个节点的唯一标识 例如：study、:lang
-	children []*node // 子节点 例如：[study, :lang]
-	isWild   bool    // 是否精确匹配，part含有 : 或 * 为true
+	typ     nodeType
+	path    string // 静态节点是压缩后的路径片段，参数节点和通配节点是参数名
+	pattern string // 完整的注册路由，只有终点节点才有值 例如：/study/:lang
+
+	handlers []HandlerFunc // 终点节点的完整执行链，中间件 > 视图函数
+
+	indices  []byte  // 静态子节点路径的首字节，和 children 一一对应
+	children []*node // 静态子节点
+
+	// 参数子节点，带约束的按照注册顺序排在前面，没有约束的最多一个，排在最后
+	paramChildren []*node
+	catchAllChild *node // 通配子节点，每个节点最多一个
+
+	constraint string            // 参数节点的约束 例如：int、[0-9]+，为空表示匹配任意一段路径
+	match      func(string) bool // constraint 对应的匹配函数
 }
 
-// 查询子节点是否含有part节点
-// [/ , user, home]
-func (n *node) search(part string) *node {
-	if n.children == nil {
-		n.children = make([]*node, 0)
+// addRoute 将 pattern 插入到以 n 为根的树中，返回终点节点
+// matchers 是可以在约束中使用的命名匹配器，约束不是匹配器的名字时按照正则表达式处理
+// 路由冲突时返回的错误信息中会同时带上新旧两个路由
+func (n *node) addRoute(pattern string, matchers map[string]ParamMatcher) (*node, error) {
+	cur := n
+	path := pattern
+	for path != "" {
+		switch path[0] {
+		case ':', '{':
+			name, constraint, rest, err := parseParam(pattern, path)
+			if err != nil {
+				return nil, err
+			}
+			child, err := cur.paramChild(pattern, name, constraint, matchers)
+			if err != nil {
+				return nil, err
+			}
+			cur, path = child, rest
+		case '*':
+			name := path[1:]
+			if strings.IndexByte(name, '/') >= 0 {
+				return nil, fmt.Errorf("web: 路由 %s 中的通配参数必须在路由末尾", pattern)
+			}
+			if err := validWildName(pattern, name); err != nil {
+				return nil, err
+			}
+			if cur.catchAllChild == nil {
+				cur.catchAllChild = &node{typ: nodeCatchAll, path: name}
+			} else if cur.catchAllChild.path != name {
+				return nil, fmt.Errorf("web: 路由冲突，%s 中的通配参数 *%s 与已注册的 %s 中的通配参数 *%s 冲突",
+					pattern, name, cur.catchAllChild.pattern, cur.catchAllChild.path)
+			}
+			cur, path = cur.catchAllChild, ""
+		default:
+			end := strings.IndexAny(path, ":*{")
+			if end < 0 {
+				end = len(path)
+			} else if path[end-1] != '/' {
+				return nil, fmt.Errorf("web: 路由 %s 中的参数必须独占一段路径", pattern)
+			}
+			cur, path = cur.insertStatic(path[:end]), path[end:]
+		}
 	}
-	for _, child := range n.children {
-		// 精确匹配，优先级高
-		if child.part == part {
+	if cur.pattern != "" {
+		return nil, fmt.Errorf("web: 路由冲突，%s 与已注册的 %s 冲突", pattern, cur.pattern)
+	}
+	cur.pattern = pattern
+	return cur, nil
+}
+
+// paramChild 找到或者创建参数名为 name、约束为 constraint 的参数子节点
+// 同一个位置可以有多个约束不同的参数，约束相同但是参数名不同时视为冲突
+func (n *node) paramChild(pattern string, name string, constraint string, matchers map[string]ParamMatcher) (*node, error) {
+	for _, child := range n.paramChildren {
+		if child.constraint != constraint {
+			continue
+		}
+		if child.path != name {
+			return nil, fmt.Errorf("web: 路由冲突，%s 中的参数 %s 与已注册的 %s 中的参数 %s 冲突",
+				pattern, name, child.anyPattern(), child.path)
+		}
+		return child, nil
+	}
+	child := &node{typ: nodeParam, path: name, constraint: constraint}
+	if constraint == "" {
+		n.paramChildren = append(n.paramChildren, child)
+		return child, nil
+	}
+	match, err := compileConstraint(constraint, matchers)
+	if err != nil {
+		return nil, fmt.Errorf("web: 路由 %s 中参数 %s 的约束 %s 既不是已注册的匹配器，也不是合法的正则表达式: %v",
+			pattern, name, constraint, err)
+	}
+	child.match = match
+	// 带约束的参数插入到没有约束的参数之前
+	i := len(n.paramChildren)
+	if i > 0 && n.paramChildren[i-1].constraint == "" {
+		i--
+	}
+	n.paramChildren = append(n.paramChildren, nil)
+	copy(n.paramChildren[i+1:], n.paramChildren[i:])
+	n.paramChildren[i] = child
+	return child, nil
+}
+
+// compileConstraint 把约束转换成匹配函数，优先使用同名的匹配器，否则按照正则表达式处理
+func compileConstraint(constraint string, matchers map[string]ParamMatcher) (func(string) bool, error) {
+	if matcher, ok := matchers[constraint]; ok {
+		return matcher, nil
+	}
+	re, err := regexp.Compile("^(?:" + constraint + ")$")
+	if err != nil {
+		return nil, err
+	}
+	return re.MatchString, nil
+}
+
+// parseParam 解析 path 开头的参数，支持三种写法：
+// :id 匹配任意一段路径；:id<int>、:slug<[a-z-]+> 尖括号中是约束；{id:[0-9]+} 冒号后面是约束
+// 约束中可以包含 /，参数依然只匹配一段路径
+func parseParam(pattern string, path string) (name string, constraint string, rest string, err error) {
+	var end int
+	hasConstraint := false
+	if path[0] == '{' {
+		end = closingIndex(path, '{', '}')
+		if end < 0 {
+			return "", "", "", fmt.Errorf("web: 路由 %s 中的 { 没有对应的 }", pattern)
+		}
+		name = path[1:end]
+		if i := strings.IndexByte(name, ':'); i >= 0 {
+			name, constraint, hasConstraint = name[:i], name[i+1:], true
+		}
+		end++
+	} else {
+		end = strings.IndexAny(path, "/<")
+		if end < 0 {
+			end = len(path)
+		}
+		name = path[1:end]
+		if end < len(path) && path[end] == '<' {
+			closing := closingIndex(path[end:], '<', '>')
+			if closing < 0 {
+				return "", "", "", fmt.Errorf("web: 路由 %s 中的 < 没有对应的 >", pattern)
+			}
+			constraint, hasConstraint = path[end+1:end+closing], true
+			end += closing + 1
+		}
+	}
+	if end < len(path) && path[end] != '/' {
+		return "", "", "", fmt.Errorf("web: 路由 %s 中的参数必须独占一段路径", pattern)
+	}
+	if err = validWildName(pattern, name); err != nil {
+		return "", "", "", err
+	}
+	if hasConstraint && constraint == "" {
+		return "", "", "", fmt.Errorf("web: 路由 %s 中参数 %s 的约束不能为空", pattern, name)
+	}
+	return name, constraint, path[end:], nil
+}
+
+// closingIndex 返回 s[0] 对应的闭合符号的位置，支持嵌套 例如正则中的 {2,3}
+func closingIndex(s string, open byte, closing byte) int {
+	depth := 0
+	for i := 0; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++ // 跳过转义的字符
+		case open:
+			depth++
+		case closing:
+			depth--
+			if depth == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// insertStatic 插入一段静态路径，必要时分裂已有节点，返回这段路径的终点节点
+func (n *node) insertStatic(path string) *node {
+	for {
+		i := bytes.IndexByte(n.indices, path[0])
+		if i < 0 {
+			child := &node{typ: nodeStatic, path: path}
+			n.indices = append(n.indices, path[0])
+			n.children = append(n.children, child)
 			return child
 		}
-		// 模糊匹配，优先级低
-		if child.isWild {
+		child := n.children[i]
+		l := commonPrefix(path, child.path)
+		if l < len(child.path) {
+			// 公共前缀比子节点短，需要把子节点一分为二
+			// 直接修改 child 指向的节点，父节点中保存的指针依然有效
+			suffix := *child
+			suffix.path = child.path[l:]
+			*child = node{
+				typ:      nodeStatic,
+				path:     child.path[:l],
+				indices:  []byte{suffix.path[0]},
+				children: []*node{&suffix},
+			}
+		}
+		path = path[l:]
+		if path == "" {
 			return child
 		}
+		n = child
+	}
+}
+
+// search 在 n 的子节点中匹配剩余的请求路径，n 自身的路径已经消耗掉了
+// 匹配到的参数会追加到 ps 中，回溯时会撤销
+func (n *node) search(path string, ps *Params) *node {
+	if path == "" {
+		if n.pattern != "" {
+			return n
+		}
+		// /static/*filepath 可以匹配 /static/
+		if n.catchAllChild != nil {
+			*ps = append(*ps, Param{Key: n.catchAllChild.path})
+			return n.catchAllChild
+		}
+		return nil
+	}
+	// 1. 静态匹配，优先级最高
+	if i := bytes.IndexByte(n.indices, path[0]); i >= 0 {
+		child := n.children[i]
+		if strings.HasPrefix(path, child.path) {
+			if res := child.search(path[len(child.path):], ps); res != nil {
+				return res
+			}
+		}
+	}
+	// 2. 参数匹配，匹配一整段路径，带约束的参数先尝试
+	if len(n.paramChildren) > 0 {
+		end := strings.IndexByte(path, '/')
+		if end < 0 {
+			end = len(path)
+		}
+		if end > 0 {
+			segment := path[:end]
+			for _, child := range n.paramChildren {
+				if child.match != nil && !child.match(segment) {
+					continue
+				}
+				size := len(*ps)
+				*ps = append(*ps, Param{Key: child.path, Value: segment})
+				if res := child.search(path[end:], ps); res != nil {
+					return res
+				}
+				*ps = (*ps)[:size] // 回溯
+			}
+		}
+	}
+	// 3. 通配匹配，优先级最低，吃掉剩余全部路径
+	if n.catchAllChild != nil {
+		*ps = append(*ps, Param{Key: n.catchAllChild.path, Value: path})
+		return n.catchAllChild
+	}
+	return nil
+}
+
+// walk 按照 静态 > 参数 > 通配 的顺序遍历子树中所有的终点节点
+func (n *node) walk(fn func(n *node)) {
+	if n.pattern != "" {
+		fn(n)
+	}
+	for _, child := range n.children {
+		child.walk(fn)
+	}
+	for _, child := range n.paramChildren {
+		child.walk(fn)
+	}
+	if n.catchAllChild != nil {
+		n.catchAllChild.walk(fn)
+	}
+}
+
+// anyPattern 返回子树中任意一个已注册的路由，用于生成冲突信息
+func (n *node) anyPattern() string {
+	if n.pattern != "" {
+		return n.pattern
+	}
+	for _, child := range n.children {
+		if p := child.anyPattern(); p != "" {
+			return p
+		}
+	}
+	for _, child := range n.paramChildren {
+		if p := child.anyPattern(); p != "" {
+			return p
+		}
+	}
+	if n.catchAllChild != nil {
+		return n.catchAllChild.anyPattern()
+	}
+	return ""
+}
+
+func validWildName(pattern string, name string) error {
+	if name == "" {
+		return fmt.Errorf("web: 路由 %s 中的参数名不能为空", pattern)
+	}
+	if strings.ContainsAny(name, ":*{}<>") {
+		return fmt.Errorf("web: 路由 %s 中的每段路径只能有一个参数", pattern)
 	}
 	return nil
 }
+
+func commonPrefix(a, b string) int {
+	i := 0
+	for i < len(a) && i < len(b) && a[i] == b[i] {
+		i++
+	}
+	return i
+}
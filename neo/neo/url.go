@@ -0,0 +1,167 @@
+package neo
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+)
+
+// Route 注册成功的路由，可以通过 Name 给它命名
+type Route struct {
+	Path   string // 完整的路由，包含路由组前缀 例如：/v1/user/:id
+	engine *Engine
+}
+
+// Name 给路由命名，之后可以通过 Engine.URL 根据名字生成地址
+// 同一个名字只能对应一个路由，例如 GET 和 POST 注册的同一个路由可以使用同一个名字
+func (r *Route) Name(name string) *Route {
+	if name == "" {
+		panic(fmt.Sprintf("web: 路由 %s 的名字不能为空", r.Path))
+	}
+	if old, ok := r.engine.namedRoutes[name]; ok {
+		if old.pattern != r.Path {
+			panic(fmt.Sprintf("web: 路由名字 %s 已经被 %s 使用", name, old.pattern))
+		}
+		return r
+	}
+	named, err := newNamedRoute(r.Path, r.engine.router.matchers)
+	if err != nil {
+		panic(err.Error())
+	}
+	r.engine.namedRoutes[name] = named
+	return r
+}
+
+// urlPart 路由的一段，静态路径或者参数
+type urlPart struct {
+	static   string
+	param    string
+	catchAll bool
+	match    func(string) bool // 参数约束，为空表示不限制
+}
+
+// namedRoute 命名路由，注册时就拆分好路由，生成地址时不用再解析
+type namedRoute struct {
+	pattern string
+	parts   []urlPart
+}
+
+func newNamedRoute(pattern string, matchers map[string]ParamMatcher) (*namedRoute, error) {
+	named := &namedRoute{pattern: pattern}
+	path := pattern
+	for path != "" {
+		switch path[0] {
+		case ':', '{':
+			name, constraint, rest, err := parseParam(pattern, path)
+			if err != nil {
+				return nil, err
+			}
+			part := urlPart{param: name}
+			if constraint != "" {
+				if part.match, err = compileConstraint(constraint, matchers); err != nil {
+					return nil, err
+				}
+			}
+			named.parts = append(named.parts, part)
+			path = rest
+		case '*':
+			named.parts = append(named.parts, urlPart{param: path[1:], catchAll: true})
+			path = ""
+		default:
+			end := strings.IndexAny(path, ":*{")
+			if end < 0 {
+				end = len(path)
+			}
+			named.parts = append(named.parts, urlPart{static: path[:end]})
+			path = path[end:]
+		}
+	}
+	return named, nil
+}
+
+// URL 根据路由名字生成地址，params 是成对的参数名和参数值
+// 路由参数填入路径并转义，其余参数作为查询参数，参数值是 []string 时生成多个同名查询参数
+// 参数值是 . 或 .. 路径段时返回错误，避免生成的地址被解析成其他路径
+// 例如：路由 /user/:id 命名为 user，engine.URL("user", "id", 42, "tab", "posts") 返回 /user/42?tab=posts
+func (e *Engine) URL(name string, params ...any) (string, error) {
+	named, ok := e.namedRoutes[name]
+	if !ok {
+		return "", fmt.Errorf("web: 没有名字为 %s 的路由", name)
+	}
+	if len(params)%2 != 0 {
+		return "", errors.New("web: URL 的参数必须是成对的参数名和参数值")
+	}
+	values := make(map[string]any, len(params)/2)
+	keys := make([]string, 0, len(params)/2)
+	for i := 0; i < len(params); i += 2 {
+		key, ok := params[i].(string)
+		if !ok {
+			return "", fmt.Errorf("web: URL 的参数名必须是字符串，实际是 %T", params[i])
+		}
+		if _, exists := values[key]; !exists {
+			keys = append(keys, key)
+		}
+		values[key] = params[i+1]
+	}
+
+	var b strings.Builder
+	for _, part := range named.parts {
+		if part.param == "" {
+			b.WriteString(part.static)
+			continue
+		}
+		raw, exists := values[part.param]
+		delete(values, part.param)
+		value := ""
+		if exists {
+			value = fmt.Sprint(raw)
+		}
+		if part.catchAll {
+			// 通配参数可以包含 /，每一段单独转义
+			// . 和 .. 会被浏览器和代理当作目录跳转，生成的地址会指向其他路由，直接拒绝
+			segments := strings.Split(strings.TrimPrefix(value, "/"), "/")
+			for i, segment := range segments {
+				if isDotSegment(segment) {
+					return "", fmt.Errorf("web: 通配参数 %s=%q 不能包含 . 或 .. 路径段", part.param, value)
+				}
+				segments[i] = url.PathEscape(segment)
+			}
+			b.WriteString(strings.Join(segments, "/"))
+			continue
+		}
+		if value == "" {
+			return "", fmt.Errorf("web: 路由 %s 缺少参数 %s", named.pattern, part.param)
+		}
+		if isDotSegment(value) {
+			return "", fmt.Errorf("web: 参数 %s=%q 不能是 . 或 ..", part.param, value)
+		}
+		if part.match != nil && !part.match(value) {
+			return "", fmt.Errorf("web: 参数 %s=%q 不满足路由 %s 的约束", part.param, value, named.pattern)
+		}
+		b.WriteString(url.PathEscape(value))
+	}
+
+	query := url.Values{}
+	for _, key := range keys {
+		raw, ok := values[key]
+		if !ok {
+			continue
+		}
+		if list, ok := raw.([]string); ok {
+			query[key] = append(query[key], list...)
+			continue
+		}
+		query.Add(key, fmt.Sprint(raw))
+	}
+	if len(query) > 0 {
+		b.WriteString("?")
+		b.WriteString(query.Encode())
+	}
+	return b.String(), nil
+}
+
+// isDotSegment 判断是否是 . 或者 .. 路径段，url.PathEscape 不会转义它们
+func isDotSegment(segment string) bool {
+	return segment == "." || segment == ".."
+}
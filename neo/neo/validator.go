@@ -0,0 +1,330 @@
+package neo
+
+import (
+	"fmt"
+	"net/mail"
+	"net/url"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode"
+	"unicode/utf8"
+)
+
+// StructValidator 结构体校验器抽象，Bind 系列方法绑定成功后会调用它
+// 可以替换成任何第三方校验库，只需要实现这个接口并设置到 Engine.Validator 上
+type StructValidator interface {
+	// ValidateStruct 校验结构体，obj 可能是结构体、结构体指针或者其他类型
+	// 校验失败推荐返回 ValidationErrors，这样框架可以直接渲染成 400 响应
+	ValidateStruct(obj any) error
+}
+
+// FieldError 单个字段的校验错误
+type FieldError struct {
+	Field string `json:"field"`           // 字段路径 例如：user.emails[0]
+	Rule  string `json:"rule"`            // 没有通过的规则 例如：min
+	Param string `json:"param,omitempty"` // 规则的参数 例如：3
+	Value any    `json:"value"`           // 字段的值
+}
+
+func (e FieldError) Error() string {
+	if e.Param != "" {
+		return fmt.Sprintf("字段 %s 不满足规则 %s=%s", e.Field, e.Rule, e.Param)
+	}
+	return fmt.Sprintf("字段 %s 不满足规则 %s", e.Field, e.Rule)
+}
+
+// ValidationErrors 校验失败的字段列表
+type ValidationErrors []FieldError
+
+func (errs ValidationErrors) Error() string {
+	messages := make([]string, 0, len(errs))
+	for _, e := range errs {
+		messages = append(messages, e.Error())
+	}
+	return "web: 参数校验失败: " + strings.Join(messages, "; ")
+}
+
+// ValidationFunc 校验规则，返回 false 表示校验失败
+// field 是字段的值，指针已经解引用；param 是规则的参数，例如 min=3 中的 3
+type ValidationFunc func(field reflect.Value, param string) bool
+
+// DefaultValidator 默认的校验器，读取 binding 标签
+// 例如：`binding:"required,min=3,max=64"`、`binding:"omitempty,email"`、`binding:"oneof=a b c"`
+// 嵌套的结构体以及结构体切片会递归校验
+type DefaultValidator struct {
+	mu    sync.RWMutex
+	rules map[string]ValidationFunc
+}
+
+// NewDefaultValidator 创建默认的校验器，内置了常用的校验规则
+func NewDefaultValidator() *DefaultValidator {
+	return &DefaultValidator{
+		rules: map[string]ValidationFunc{
+			"required": func(field reflect.Value, _ string) bool { return field.IsValid() && !field.IsZero() },
+			"min":      func(field reflect.Value, param string) bool { return compareRule(field, param, 0, 1) },
+			"max":      func(field reflect.Value, param string) bool { return compareRule(field, param, -1, 0) },
+			"len":      func(field reflect.Value, param string) bool { return compareRule(field, param, 0, 0) },
+			"eq":       equalRule,
+			"gt":       func(field reflect.Value, param string) bool { return compareRule(field, param, 1, 1) },
+			"gte":      func(field reflect.Value, param string) bool { return compareRule(field, param, 0, 1) },
+			"lt":       func(field reflect.Value, param string) bool { return compareRule(field, param, -1, -1) },
+			"lte":      func(field reflect.Value, param string) bool { return compareRule(field, param, -1, 0) },
+			"ne":       func(field reflect.Value, param string) bool { return !equalRule(field, param) },
+			"oneof":    oneOfRule,
+			"email":    emailRule,
+			"url":      urlRule,
+			"alpha":    stringRule(unicode.IsLetter),
+			"numeric":  stringRule(unicode.IsDigit),
+			"alphanum": stringRule(func(r rune) bool { return unicode.IsLetter(r) || unicode.IsDigit(r) }),
+		},
+	}
+}
+
+// RegisterRule 注册自定义校验规则，同名规则会被覆盖
+func (v *DefaultValidator) RegisterRule(name string, fn ValidationFunc) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	v.rules[name] = fn
+}
+
+// ValidateStruct 实现 StructValidator 接口
+func (v *DefaultValidator) ValidateStruct(obj any) error {
+	rv := reflect.ValueOf(obj)
+	for rv.Kind() == reflect.Pointer {
+		if rv.IsNil() {
+			return nil
+		}
+		rv = rv.Elem()
+	}
+	errs := make(ValidationErrors, 0)
+	v.mu.RLock()
+	defer v.mu.RUnlock()
+	v.validate(rv, "", &errs)
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// validate 递归校验 rv，path 是当前值的字段路径
+func (v *DefaultValidator) validate(rv reflect.Value, path string, errs *ValidationErrors) {
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if !rv.IsNil() {
+			v.validate(rv.Elem(), path, errs)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < rv.Len(); i++ {
+			v.validate(rv.Index(i), fmt.Sprintf("%s[%d]", path, i), errs)
+		}
+	case reflect.Map:
+		iter := rv.MapRange()
+		for iter.Next() {
+			v.validate(iter.Value(), fmt.Sprintf("%s[%v]", path, iter.Key()), errs)
+		}
+	case reflect.Struct:
+		if rv.Type() == timeType {
+			return
+		}
+		rt := rv.Type()
+		for i := 0; i < rt.NumField(); i++ {
+			sf := rt.Field(i)
+			if !sf.IsExported() {
+				continue
+			}
+			fieldPath := fieldName(sf)
+			if sf.Anonymous {
+				// 匿名嵌入的字段路径不变
+				fieldPath = path
+			} else if path != "" {
+				fieldPath = path + "." + fieldPath
+			}
+			fv := rv.Field(i)
+			if tag := sf.Tag.Get("binding"); tag != "" && tag != "-" {
+				if !v.validateField(fv, fieldPath, tag, errs) {
+					continue
+				}
+			}
+			v.validate(fv, fieldPath, errs)
+		}
+	}
+}
+
+// validateField 按照 binding 标签依次校验单个字段，返回是否需要继续校验字段内部
+func (v *DefaultValidator) validateField(fv reflect.Value, path string, tag string, errs *ValidationErrors) bool {
+	value := fv
+	for value.Kind() == reflect.Pointer && !value.IsNil() {
+		value = value.Elem()
+	}
+	for _, rule := range strings.Split(tag, ",") {
+		name, param, _ := strings.Cut(strings.TrimSpace(rule), "=")
+		switch name {
+		case "":
+			continue
+		case "omitempty":
+			if fv.IsZero() {
+				return false
+			}
+			continue
+		case "required":
+			// 指针只要不是 nil 就满足 required
+			if fv.Kind() == reflect.Pointer {
+				if fv.IsNil() {
+					*errs = append(*errs, FieldError{Field: path, Rule: name})
+					return false
+				}
+				continue
+			}
+		}
+		fn, ok := v.rules[name]
+		if !ok {
+			panic(fmt.Sprintf("web: 未注册的校验规则 %s", name))
+		}
+		if value.Kind() == reflect.Pointer {
+			// 可选的指针字段是 nil，没有需要校验的值
+			return false
+		}
+		if !fn(value, param) {
+			var actual any
+			if value.CanInterface() {
+				actual = value.Interface()
+			}
+			*errs = append(*errs, FieldError{Field: path, Rule: name, Param: param, Value: actual})
+			return false
+		}
+	}
+	return true
+}
+
+// fieldName 字段路径优先使用 json 标签，和接口返回给前端的字段名保持一致
+func fieldName(sf reflect.StructField) string {
+	if tag, ok := sf.Tag.Lookup("json"); ok {
+		if name, _, _ := strings.Cut(tag, ","); name != "" && name != "-" {
+			return name
+		}
+	}
+	return sf.Name
+}
+
+// compareRule 比较字段和参数的大小，字符串、切片、map 比较长度，数字比较数值
+// 比较结果 -1、0、1 落在 [lo, hi] 区间内即为通过
+func compareRule(field reflect.Value, param string, lo int, hi int) bool {
+	var cmp int
+	switch field.Kind() {
+	case reflect.String:
+		n, err := strconv.Atoi(param)
+		if err != nil {
+			panic(fmt.Sprintf("web: 校验规则参数 %s 不是数字", param))
+		}
+		cmp = compareInt(int64(utf8.RuneCountInString(field.String())), int64(n))
+	case reflect.Slice, reflect.Array, reflect.Map:
+		n, err := strconv.Atoi(param)
+		if err != nil {
+			panic(fmt.Sprintf("web: 校验规则参数 %s 不是数字", param))
+		}
+		cmp = compareInt(int64(field.Len()), int64(n))
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(param, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("web: 校验规则参数 %s 不是整数", param))
+		}
+		cmp = compareInt(field.Int(), n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(param, 10, 64)
+		if err != nil {
+			panic(fmt.Sprintf("web: 校验规则参数 %s 不是整数", param))
+		}
+		switch {
+		case field.Uint() < n:
+			cmp = -1
+		case field.Uint() > n:
+			cmp = 1
+		}
+	case reflect.Float32, reflect.Float64:
+		f, err := strconv.ParseFloat(param, 64)
+		if err != nil {
+			panic(fmt.Sprintf("web: 校验规则参数 %s 不是数字", param))
+		}
+		switch {
+		case field.Float() < f:
+			cmp = -1
+		case field.Float() > f:
+			cmp = 1
+		}
+	default:
+		return false
+	}
+	return cmp >= lo && cmp <= hi
+}
+
+func compareInt(a int64, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// equalRule 字符串直接比较内容，其他类型和 compareRule 一致
+func equalRule(field reflect.Value, param string) bool {
+	if field.Kind() == reflect.String {
+		return field.String() == param
+	}
+	return compareRule(field, param, 0, 0)
+}
+
+// oneOfRule 参数使用空格分隔 例如：oneof=red green blue
+func oneOfRule(field reflect.Value, param string) bool {
+	var value string
+	switch field.Kind() {
+	case reflect.String:
+		value = field.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		value = strconv.FormatInt(field.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		value = strconv.FormatUint(field.Uint(), 10)
+	default:
+		return false
+	}
+	for _, option := range strings.Fields(param) {
+		if option == value {
+			return true
+		}
+	}
+	return false
+}
+
+func emailRule(field reflect.Value, _ string) bool {
+	if field.Kind() != reflect.String {
+		return false
+	}
+	addr, err := mail.ParseAddress(field.String())
+	return err == nil && addr.Address == field.String()
+}
+
+func urlRule(field reflect.Value, _ string) bool {
+	if field.Kind() != reflect.String {
+		return false
+	}
+	u, err := url.Parse(field.String())
+	return err == nil && u.Scheme != "" && u.Host != ""
+}
+
+// stringRule 字符串的每个字符都满足 fn，空字符串不满足
+func stringRule(fn func(r rune) bool) ValidationFunc {
+	return func(field reflect.Value, _ string) bool {
+		if field.Kind() != reflect.String || field.Len() == 0 {
+			return false
+		}
+		for _, r := range field.String() {
+			if !fn(r) {
+				return false
+			}
+		}
+		return true
+	}
+}